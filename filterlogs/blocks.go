@@ -0,0 +1,164 @@
+package filterlogs
+
+import (
+	"sort"
+	"tocsv/logparser"
+
+	"github.com/parmaanu/goutils/algoutils"
+)
+
+const (
+	// gNestedBlocksClose closes the open block when StartBlockPattern is found again, it is the default
+	gNestedBlocksClose = "close"
+	// gNestedBlocksIgnore treats StartBlockPattern inside an open block as a normal logline of the block
+	gNestedBlocksIgnore = "ignore"
+)
+
+// block stores the values of the elements found in the loglines of a log block
+type block struct {
+	tag      string
+	info     logparser.LineInfo // LineInfo of the first logline of the block
+	line     string             // first logline of the block
+	values   map[string]*FilteredData
+	openedAt int // number of loglines seen by the app when the block is opened
+}
+
+// blockTracker assembles the loglines of an app into log blocks, each log block results in a single record.
+// A block is opened by StartBlockPattern and closed by EndBlockPattern. If only one of them is provided then the
+// blocks are delimited by that pattern. When BlockKey is provided, loglines are assigned to the open block with the
+// same value of BlockKey element, so multiple interleaved blocks can be open at the same time.
+type blockTracker struct {
+	appconfig *AppConfig
+	callback  ClientCallbackType
+	blocks    map[string]*block // key is the value of BlockKey element
+	lineCount int
+	// aborted returns true if the processing is aborted, open blocks are not passed to the client after that
+	aborted func() bool
+}
+
+func newBlockTracker(appconfig *AppConfig, callback ClientCallbackType, aborted func() bool) *blockTracker {
+	return &blockTracker{
+		appconfig: appconfig,
+		callback:  callback,
+		blocks:    make(map[string]*block),
+		aborted:   aborted,
+	}
+}
+
+// processLine adds the values found in the line to its block. tag is the Tag of the logline config, it is empty for
+// the lines which only match the block patterns.
+func (bt *blockTracker) processLine(line string, info logparser.LineInfo, tag string, values map[string]*FilteredData) {
+	appconfig := bt.appconfig
+	bt.lineCount++
+	bt.closeTimedOutBlocks()
+
+	blockKey := ""
+	if len(appconfig.BlockKey) > 0 {
+		value, found := values[appconfig.BlockKey]
+		if !found && len(tag) == 0 {
+			value, found = appconfig.lineBlockKey(line)
+		}
+		// loglines without BlockKey cannot be assigned to any block
+		if !found {
+			return
+		}
+		blockKey = value.Text
+	}
+	isStart := appconfig.hasStartBlockPattern && algoutils.StringContainsAll(line, appconfig.StartBlockPattern)
+	isEnd := appconfig.hasEndBlockPattern && algoutils.StringContainsAll(line, appconfig.EndBlockPattern)
+
+	currentBlock, isOpen := bt.blocks[blockKey]
+	if isStart && isOpen && appconfig.NestedBlocks != gNestedBlocksIgnore {
+		// without EndBlockPattern blocks are delimited by StartBlockPattern, so the open block is complete
+		bt.closeBlock(blockKey, !appconfig.hasEndBlockPattern)
+		isOpen = false
+	}
+	if !isOpen {
+		// loglines outside of the blocks are ignored
+		if appconfig.hasStartBlockPattern && !isStart {
+			return
+		}
+		currentBlock = &block{tag: tag, info: info, line: line, values: make(map[string]*FilteredData), openedAt: bt.lineCount}
+		bt.blocks[blockKey] = currentBlock
+	}
+
+	if len(currentBlock.tag) == 0 {
+		currentBlock.tag = tag
+	}
+	for elementKey, filteredData := range values {
+		currentBlock.values[elementKey] = filteredData
+	}
+
+	if isEnd {
+		bt.closeBlock(blockKey, true)
+	}
+}
+
+// lineBlockKey returns the value of BlockKey in a line which only matches the block patterns, it is extracted by the
+// loglines having the BlockKey element
+func (appconfig *AppConfig) lineBlockKey(line string) (*FilteredData, bool) {
+	for _, logline := range appconfig.LogLines {
+		values, err := logline.extractValues(line)
+		if value, found := values[appconfig.BlockKey]; err == nil && found && value.Text != NotFound {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// closeTimedOutBlocks closes the blocks which are open for more than BlockTimeout loglines
+func (bt *blockTracker) closeTimedOutBlocks() {
+	if bt.appconfig.BlockTimeout <= 0 {
+		return
+	}
+	for _, blockKey := range bt.sortedBlockKeys() {
+		if bt.lineCount-bt.blocks[blockKey].openedAt > bt.appconfig.BlockTimeout {
+			bt.closeBlock(blockKey, false)
+		}
+	}
+}
+
+// closeBlock removes the block and passes its values to the client. Incomplete blocks are dropped if
+// DropIncompleteBlocks is set.
+func (bt *blockTracker) closeBlock(blockKey string, complete bool) {
+	closedBlock := bt.blocks[blockKey]
+	delete(bt.blocks, blockKey)
+	if bt.aborted() || len(closedBlock.values) == 0 || (!complete && bt.appconfig.DropIncompleteBlocks) {
+		return
+	}
+	bt.appconfig.fillForward(closedBlock.values)
+	if !bt.appconfig.inTimeRange(closedBlock.values, closedBlock.line) {
+		return
+	}
+	bt.appconfig.computeColumns(closedBlock.values)
+	bt.appconfig.computeDeltaColumns(closedBlock.tag, closedBlock.values)
+	if !bt.appconfig.matchesWhere(closedBlock.values) {
+		return
+	}
+	bt.appconfig.ClientConfig.Tag = closedBlock.tag
+	bt.appconfig.ClientConfig.Source = closedBlock.info.Source
+	bt.appconfig.ClientConfig.LineNo = closedBlock.info.LineNo
+	bt.appconfig.ClientConfig.Offset = closedBlock.info.Offset
+	bt.appconfig.ClientConfig.LogLine = closedBlock.line
+	bt.callback(bt.appconfig.ClientConfig, closedBlock.values)
+}
+
+// flush closes all the open blocks in the order they are opened, it is called after reading all the loglines
+func (bt *blockTracker) flush() {
+	for _, blockKey := range bt.sortedBlockKeys() {
+		// without EndBlockPattern the last block is complete
+		bt.closeBlock(blockKey, !bt.appconfig.hasEndBlockPattern)
+	}
+}
+
+// sortedBlockKeys returns the keys of the open blocks in the order they are opened
+func (bt *blockTracker) sortedBlockKeys() []string {
+	blockKeys := make([]string, 0, len(bt.blocks))
+	for blockKey := range bt.blocks {
+		blockKeys = append(blockKeys, blockKey)
+	}
+	sort.Slice(blockKeys, func(i, j int) bool {
+		return bt.blocks[blockKeys[i]].openedAt < bt.blocks[blockKeys[j]].openedAt
+	})
+	return blockKeys
+}
@@ -0,0 +1,291 @@
+package filterlogs
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Knetic/govaluate"
+)
+
+// ComputedColumnConfig stores the config of a column which is calculated from the other elements of the record
+type ComputedColumnConfig struct {
+	ElementKey string `yaml:"ElementKey"`
+	ColumnName string `yaml:"ColumnName"`
+	// Expression is evaluated using govaluate, it can reference the element keys or column names of the app and the
+	// computed columns given before it, e.g. 'PriceKey * QuantityKey' or "if(side == 'BUY', bid, ask)". String
+	// literals are given in single quotes.
+	Expression string `yaml:"Expression"`
+
+	expression *govaluate.EvaluableExpression
+}
+
+// gExpressionFunctions are the functions available in the expressions along with the operators of govaluate
+var gExpressionFunctions = map[string]govaluate.ExpressionFunction{
+	// arithmetic
+	"abs":   floatFunction("abs", math.Abs),
+	"floor": floatFunction("floor", math.Floor),
+	"ceil":  floatFunction("ceil", math.Ceil),
+	"round": func(args ...interface{}) (interface{}, error) {
+		if len(args) < 1 || len(args) > 2 {
+			return nil, fmt.Errorf("round expects a number and optional digits, got %d arguments", len(args))
+		}
+		value, ok := args[0].(float64)
+		if !ok {
+			return nil, fmt.Errorf("round expects a number, got %v", args[0])
+		}
+		digits := 0.0
+		if len(args) == 2 {
+			if digits, ok = args[1].(float64); !ok {
+				return nil, fmt.Errorf("round expects number of digits, got %v", args[1])
+			}
+		}
+		scale := math.Pow(10, digits)
+		return math.Round(value*scale) / scale, nil
+	},
+	"min": func(args ...interface{}) (interface{}, error) {
+		return foldFloats("min", args, math.Min)
+	},
+	"max": func(args ...interface{}) (interface{}, error) {
+		return foldFloats("max", args, math.Max)
+	},
+
+	// string
+	"upper": stringFunction("upper", strings.ToUpper),
+	"lower": stringFunction("lower", strings.ToLower),
+	"trim":  stringFunction("trim", strings.TrimSpace),
+	"len": func(args ...interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("len expects 1 argument, got %d", len(args))
+		}
+		return float64(len(formatComputedValue(args[0]))), nil
+	},
+	"concat": func(args ...interface{}) (interface{}, error) {
+		texts := make([]string, len(args))
+		for i, arg := range args {
+			texts[i] = formatComputedValue(arg)
+		}
+		return strings.Join(texts, ""), nil
+	},
+	"contains": func(args ...interface{}) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("contains expects 2 arguments, got %d", len(args))
+		}
+		return strings.Contains(formatComputedValue(args[0]), formatComputedValue(args[1])), nil
+	},
+	"replace": func(args ...interface{}) (interface{}, error) {
+		if len(args) != 3 {
+			return nil, fmt.Errorf("replace expects 3 arguments, got %d", len(args))
+		}
+		return strings.ReplaceAll(formatComputedValue(args[0]), formatComputedValue(args[1]), formatComputedValue(args[2])), nil
+	},
+	"substr": func(args ...interface{}) (interface{}, error) {
+		if len(args) != 3 {
+			return nil, fmt.Errorf("substr expects a string, start and end, got %d arguments", len(args))
+		}
+		text := formatComputedValue(args[0])
+		start, ok1 := args[1].(float64)
+		end, ok2 := args[2].(float64)
+		if !ok1 || !ok2 || start < 0 || start > end || int(end) > len(text) {
+			return nil, fmt.Errorf("substr indices out of range, %v %v %s", args[1], args[2], text)
+		}
+		return text[int(start):int(end)], nil
+	},
+
+	// conditional
+	"if": func(args ...interface{}) (interface{}, error) {
+		if len(args) != 3 {
+			return nil, fmt.Errorf("if expects a condition and 2 values, got %d arguments", len(args))
+		}
+		condition, ok := args[0].(bool)
+		if !ok {
+			return nil, fmt.Errorf("if expects a boolean condition, got %v", args[0])
+		}
+		if condition {
+			return args[1], nil
+		}
+		return args[2], nil
+	},
+}
+
+func floatFunction(name string, f func(float64) float64) govaluate.ExpressionFunction {
+	return func(args ...interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%s expects 1 argument, got %d", name, len(args))
+		}
+		value, ok := args[0].(float64)
+		if !ok {
+			return nil, fmt.Errorf("%s expects a number, got %v", name, args[0])
+		}
+		return f(value), nil
+	}
+}
+
+func foldFloats(name string, args []interface{}, f func(float64, float64) float64) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("%s expects at least 1 argument", name)
+	}
+	result := 0.0
+	for i, arg := range args {
+		value, ok := arg.(float64)
+		if !ok {
+			return nil, fmt.Errorf("%s expects numbers, got %v", name, arg)
+		}
+		if i == 0 {
+			result = value
+			continue
+		}
+		result = f(result, value)
+	}
+	return result, nil
+}
+
+func stringFunction(name string, f func(string) string) govaluate.ExpressionFunction {
+	return func(args ...interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%s expects 1 argument, got %d", name, len(args))
+		}
+		return f(formatComputedValue(args[0])), nil
+	}
+}
+
+// expressionParameter converts the value of an element into a govaluate parameter. Numbers are passed as float64,
+// durations as seconds and texts which look like numbers are converted to float64.
+func expressionParameter(filteredData *FilteredData) (interface{}, bool) {
+	switch value := filteredData.Value.(type) {
+	case int64:
+		return float64(value), true
+	case float64, bool, string:
+		return value, true
+	case *big.Rat:
+		f, _ := value.Float64()
+		return f, true
+	case time.Duration:
+		return value.Seconds(), true
+	case time.Time:
+		return value, true
+	}
+	if filteredData.Text == NotFound {
+		return nil, false
+	}
+	if f, err := strconv.ParseFloat(filteredData.Text, 64); err == nil {
+		return f, true
+	}
+	return filteredData.Text, true
+}
+
+// formatComputedValue returns the text of the result of an expression
+func formatComputedValue(value interface{}) string {
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return v
+	}
+	return fmt.Sprint(value)
+}
+
+// compile compiles the Expression and verifies that the parameters of the expression are known
+func (cc *ComputedColumnConfig) compile(knownKeys map[string]bool) error {
+	if len(cc.ElementKey) == 0 || len(cc.Expression) == 0 {
+		return fmt.Errorf("please provide ElementKey and Expression, e.g. {ElementKey: NotionalKey, Expression: 'PriceKey * QuantityKey'}")
+	}
+	expression, err := govaluate.NewEvaluableExpressionWithFunctions(cc.Expression, gExpressionFunctions)
+	if err != nil {
+		return err
+	}
+	for _, variable := range expression.Vars() {
+		if !knownKeys[variable] {
+			return fmt.Errorf("unknown element %q in Expression %q", variable, cc.Expression)
+		}
+	}
+	cc.expression = expression
+	return nil
+}
+
+// verifyComputedColumns compiles the ComputedColumns of the app and appends them to the MetaInfo. It is called after
+// storing the MetaInfo of the elements of the app.
+func (appconfig *AppConfig) verifyComputedColumns() bool {
+	knownKeys := map[string]bool{}
+	for _, metaInfo := range appconfig.ClientConfig.MetaInfo {
+		knownKeys[metaInfo.ElementKey] = true
+		if len(metaInfo.ColumnName) > 0 {
+			knownKeys[metaInfo.ColumnName] = true
+		}
+	}
+	for _, cc := range appconfig.ComputedColumns {
+		if knownKeys[cc.ElementKey] {
+			fmt.Println("ElementKey of the computed column is already used, please provide a unique ElementKey", appconfig.AppName, cc.ElementKey)
+			return false
+		}
+		if err := cc.compile(knownKeys); err != nil {
+			fmt.Println("Invalid ComputedColumns config,", err, appconfig.AppName, cc.ElementKey)
+			return false
+		}
+		appconfig.ClientConfig.MetaInfo = append(appconfig.ClientConfig.MetaInfo, &MetaInfoType{ElementKey: cc.ElementKey, ColumnName: cc.ColumnName})
+		knownKeys[cc.ElementKey] = true
+		if len(cc.ColumnName) > 0 {
+			knownKeys[cc.ColumnName] = true
+		}
+	}
+	return true
+}
+
+// expressionParameters are the parameters of the expressions evaluated for a record, each value is available by its
+// element key and by its column name
+type expressionParameters struct {
+	columnNames map[string]string // key is element key
+	parameters  map[string]interface{}
+}
+
+func newExpressionParameters(columnNames map[string]string, values map[string]*FilteredData) *expressionParameters {
+	ep := &expressionParameters{columnNames: columnNames, parameters: map[string]interface{}{}}
+	for elementKey, filteredData := range values {
+		ep.add(elementKey, filteredData)
+	}
+	return ep
+}
+
+func (ep *expressionParameters) add(elementKey string, filteredData *FilteredData) {
+	parameter, ok := expressionParameter(filteredData)
+	if !ok {
+		return
+	}
+	ep.parameters[elementKey] = parameter
+	if columnName, exists := ep.columnNames[elementKey]; exists {
+		if _, alreadyExists := ep.parameters[columnName]; !alreadyExists {
+			ep.parameters[columnName] = parameter
+		}
+	}
+}
+
+// columnNames returns the column names of the elements and the computed columns of the app, key is element key
+func (appconfig *AppConfig) columnNames() map[string]string {
+	columnNames := map[string]string{}
+	for _, metaInfo := range appconfig.metaInfo {
+		if len(metaInfo.ColumnName) > 0 {
+			columnNames[metaInfo.ElementKey] = metaInfo.ColumnName
+		}
+	}
+	return columnNames
+}
+
+// computeColumns evaluates the ComputedColumns of the app and adds them to the values. A column is N/F if any element
+// used in its expression is not found or the expression cannot be evaluated for the record.
+func (appconfig *AppConfig) computeColumns(values map[string]*FilteredData) {
+	if len(appconfig.ComputedColumns) == 0 {
+		return
+	}
+	ep := newExpressionParameters(appconfig.elementColumnNames, values)
+	for _, cc := range appconfig.ComputedColumns {
+		filteredData := &FilteredData{Text: NotFound}
+		if result, err := cc.expression.Evaluate(ep.parameters); err == nil && result != nil {
+			filteredData = &FilteredData{Text: formatComputedValue(result), Value: result}
+		}
+		values[cc.ElementKey] = filteredData
+		ep.add(cc.ElementKey, filteredData)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"os"
 	"strings"
 
+	"github.com/Knetic/govaluate"
 	"github.com/goccy/go-yaml"
 
 	"github.com/lithammer/dedent"
@@ -20,31 +21,76 @@ import (
 type MetaInfoType struct {
 	ElementKey string
 	ColumnName string
+	Type       string // Type of the element, empty for text
+	Layout     string // Layout of the timestamp Type
 }
 
 // ClientConfigType contains the config for client applications after extracting the pattern.
 type ClientConfigType struct {
 	AppName  string
 	Tag      string // this tag changes for each matched logline // TODO, find a way to find out a better way to pass on dynamic config for each logline (or log block)
+	Source   string // input file of the logline (first logline of the log block), "-" for stdin
+	LineNo   int    // line number of the logline (first logline of the log block) in the Source
+	Offset   int64  // byte offset of the logline (first logline of the log block) in the Source
+	LogLine  string // the logline (first logline of the log block)
 	MetaInfo []*MetaInfoType
 }
 
 // AppConfig stores the configuration for an individual app
 type AppConfig struct {
-	AppName           string           `yaml:"AppName"`
-	StartBlockPattern []string         `yaml:"StartBlockPattern"`
-	EndBlockPattern   []string         `yaml:"EndBlockPattern"`
-	OutputElements    []string         `yaml:"OutputElements"`
-	LogLines          []*LogLineConfig `yaml:"LogLines"`
+	AppName           string   `yaml:"AppName"`
+	StartBlockPattern []string `yaml:"StartBlockPattern"`
+	EndBlockPattern   []string `yaml:"EndBlockPattern"`
+	// BlockKey is the element key which correlates the loglines of interleaved blocks, e.g. orderId. It is extracted
+	// from the lines which only match the block patterns using its element config in the loglines.
+	BlockKey string `yaml:"BlockKey"`
+	// BlockTimeout is the number of loglines of the app after which an open block is closed as incomplete
+	BlockTimeout int `yaml:"BlockTimeout"`
+	// DropIncompleteBlocks drops the blocks which are closed by BlockTimeout, a nested StartBlockPattern or the end of
+	// input instead of passing them to the client
+	DropIncompleteBlocks bool `yaml:"DropIncompleteBlocks"`
+	// NestedBlocks is either close (default) or ignore. It decides if StartBlockPattern inside an open block closes
+	// the open block or it is treated as a normal logline of the open block.
+	NestedBlocks string `yaml:"NestedBlocks"`
+	// OutputElements selects the element keys for the output columns in the given order. Element keys prefixed with
+	// '-' are excluded from the output and the rest are kept in their default order, e.g. ['-BidKey', '-AskKey'].
+	// All the elements are in the output if it is empty.
+	OutputElements []string         `yaml:"OutputElements"`
+	LogLines       []*LogLineConfig `yaml:"LogLines"`
+	// ComputedColumns are calculated from the other elements of each record and appended to the output columns
+	ComputedColumns []*ComputedColumnConfig `yaml:"ComputedColumns"`
+	// DeltaColumns are the changes of the values since the previous record, they are appended after the ComputedColumns
+	DeltaColumns []*DeltaColumnConfig `yaml:"DeltaColumns"`
+	// TimestampElement is the element key whose value is compared with Since and Until, LineTimestamp of the first
+	// logline of each record is used if it is empty
+	TimestampElement string `yaml:"TimestampElement"`
+	// TimestampLayout is the layout of TimestampElement, default is the Layout of the element with Type timestamp
+	TimestampLayout string `yaml:"TimestampLayout"`
+	// Where keeps only the records for which the expression is true, it is evaluated using govaluate after the
+	// ComputedColumns, e.g. "side == 'BUY' && quantity > 500" or 'securityId in [999, 154]'
+	Where string `yaml:"Where"`
 
 	hasStartBlockPattern bool
 	hasEndBlockPattern   bool
+	metaInfo             []*MetaInfoType   // all the elements and computed columns of the app
+	elementColumnNames   map[string]string // column names of the metaInfo, key is element key
+	timeRange            *timeRange
+	lineTimestamp        *TimestampConfig
+	whereExpressions     []*govaluate.EvaluableExpression
+	droppedByWhere       bool // records are dropped as the app does not have the elements used in --where
+	fillState            *fillForwardState
 	ClientConfig         *ClientConfigType
 }
 
 // Config is the main application config
 type Config struct {
-	Apps []*AppConfig `yaml:"Apps"`
+	// LineTimestamp is used to merge the loglines of multiple input files in the chronological order
+	LineTimestamp *TimestampConfig `yaml:"LineTimestamp"`
+	// Since and Until keep only the records whose timestamp is in [Since, Until), e.g. '2020-12-31 09:15:00'. Only
+	// the time of the day is compared if they are given without a date, e.g. '09:15'.
+	Since string       `yaml:"Since"`
+	Until string       `yaml:"Until"`
+	Apps  []*AppConfig `yaml:"Apps"`
 }
 
 // NewConfig returns a config instance after reading configFiles
@@ -88,7 +134,21 @@ func NewConfig(configFile string, anchorFiles []string) *Config {
 
 // Verify verifies the config file
 func (config *Config) Verify() bool {
-	return config.verifyAppConfig() && config.verifyLoglineConfig()
+	return config.verifyAppConfig() && config.verifyLoglineConfig() && config.verifyLineTimestamp() &&
+		config.verifyTimeRange()
+}
+
+func (config *Config) verifyLineTimestamp() bool {
+	if config.LineTimestamp == nil {
+		return true
+	}
+	exampleLines := []string{}
+	for _, appconfig := range config.Apps {
+		for _, logline := range appconfig.LogLines {
+			exampleLines = append(exampleLines, logline.ExampleLine)
+		}
+	}
+	return config.LineTimestamp.verify("LineTimestamp", exampleLines)
 }
 
 func (config *Config) verifyAppConfig() bool {
@@ -103,6 +163,8 @@ func (config *Config) verifyAppConfig() bool {
 			return false
 		}
 		// appconfig.ClientConfig = &ClientConfigType{AppName: appconfig.AppName}
+		appconfig.hasStartBlockPattern = len(appconfig.StartBlockPattern) > 0 && len(appconfig.StartBlockPattern[0]) > 0
+		appconfig.hasEndBlockPattern = len(appconfig.EndBlockPattern) > 0 && len(appconfig.EndBlockPattern[0]) > 0
 		if len(appconfig.LogLines) == 0 {
 			fmt.Println("No LogLines found in the config. Please provide LogLines config")
 			return false
@@ -126,7 +188,7 @@ func (config *Config) verifyAppConfig() bool {
 				return false
 			}
 
-			if len(logline.Elements) == 0 {
+			if len(logline.Elements) == 0 && len(logline.Regex) == 0 {
 				exampleElements := dedent.Dedent(`
 			Elements:
 			  TimestampKey:
@@ -139,7 +201,7 @@ func (config *Config) verifyAppConfig() bool {
 				EndPattern: ','
 				AllowEmpty: true
 			`)
-				fmt.Println("Please provide Elements to be printed in output csv file", logline, ". Following is an example:", exampleElements)
+				fmt.Println("Please provide Elements or Regex to be printed in output csv file", logline, ". Following is an example:", exampleElements)
 				return false
 			}
 		} // LogLines loop
@@ -154,13 +216,16 @@ func (config *Config) verifyLoglineConfig() bool {
 		for _, logline := range appconfig.LogLines {
 			columnNames := []string{}
 
+			if !verifyLoglineRegex(logline) {
+				return false
+			}
+
 			for eleKey, ele := range logline.Elements {
 
-				appconfig.hasStartBlockPattern = len(appconfig.StartBlockPattern) > 0 && len(appconfig.StartBlockPattern[0]) > 0
-				appconfig.hasEndBlockPattern = len(appconfig.EndBlockPattern) > 0 && len(appconfig.EndBlockPattern[0]) > 0
 				if appconfig.hasStartBlockPattern && appconfig.hasEndBlockPattern {
-					// check for repeatative element key across different log lines
-					if findutils.ContainsString(elementKeys, eleKey) {
+					// check for repeatative element key across different log lines, BlockKey is present in all the
+					// loglines of a block
+					if eleKey != appconfig.BlockKey && findutils.ContainsString(elementKeys, eleKey) {
 						fmt.Println("Repeated ElementKeys found in LogLines config, Please provide unique element keys within an app", logline.Tag, eleKey)
 						return false
 					}
@@ -174,6 +239,22 @@ func (config *Config) verifyLoglineConfig() bool {
 					columnNames = append(columnNames, ele.ColumnName)
 				}
 
+				if !verifyElementType(logline, eleKey, ele) {
+					return false
+				}
+				if ele.isRegexGroup {
+					continue
+				}
+				if !verifyElementPosition(logline, eleKey, ele) {
+					return false
+				}
+				if len(ele.Regex) > 0 {
+					if !verifyElementRegex(logline, eleKey, ele) {
+						return false
+					}
+					continue
+				}
+
 				if ele.StartPattern != gStartOfLine && !strings.Contains(logline.ExampleLine, ele.StartPattern) {
 					fmt.Println("StartPattern not found in ExampleLine, StartPattern:", ele.StartPattern, logline.Tag, eleKey, ele, logline.ExampleLine)
 					return false
@@ -199,11 +280,153 @@ func (config *Config) verifyLoglineConfig() bool {
 					return false
 				}
 			}
+			if !verifyExampleLineTypes(logline) {
+				return false
+			}
+		}
+		// BlockKey is verified after compiling the logline Regex as it can be a named group
+		if !appconfig.verifyBlockConfig() {
+			return false
 		}
 	}
 	return true
 }
 
+func (appconfig *AppConfig) verifyBlockConfig() bool {
+	hasBlockPattern := appconfig.hasStartBlockPattern || appconfig.hasEndBlockPattern
+	if !hasBlockPattern && (len(appconfig.BlockKey) > 0 || appconfig.BlockTimeout > 0) {
+		fmt.Println("BlockKey and BlockTimeout are supported only with StartBlockPattern or EndBlockPattern", appconfig.AppName)
+		return false
+	}
+	if appconfig.BlockTimeout < 0 {
+		fmt.Println("Negative BlockTimeout is not supported", appconfig.AppName, appconfig.BlockTimeout)
+		return false
+	}
+	if len(appconfig.NestedBlocks) > 0 && appconfig.NestedBlocks != gNestedBlocksClose && appconfig.NestedBlocks != gNestedBlocksIgnore {
+		fmt.Println("NestedBlocks should be either", gNestedBlocksClose, "or", gNestedBlocksIgnore, appconfig.AppName, appconfig.NestedBlocks)
+		return false
+	}
+	if len(appconfig.BlockKey) == 0 {
+		return true
+	}
+	for _, logline := range appconfig.LogLines {
+		if _, exists := logline.Elements[appconfig.BlockKey]; exists {
+			return true
+		}
+		if findutils.ContainsString(logline.regexElementKeys(), appconfig.BlockKey) {
+			return true
+		}
+	}
+	fmt.Println("BlockKey is not an element key of any logline", appconfig.AppName, appconfig.BlockKey)
+	return false
+}
+
+func verifyLoglineRegex(logline *LogLineConfig) bool {
+	if len(logline.Regex) == 0 {
+		return true
+	}
+	if err := logline.compileRegex(); err != nil {
+		fmt.Println("Cannot compile Regex of the logline config", logline.Tag, logline.Regex, err)
+		return false
+	}
+	elementKeys := logline.regexElementKeys()
+	if len(elementKeys) == 0 {
+		fmt.Println("Please provide named capturing groups in the logline Regex, e.g. 'side: (?P<SideKey>\\w+)'", logline.Tag, logline.Regex)
+		return false
+	}
+	if !logline.regex.MatchString(logline.ExampleLine) {
+		fmt.Println("Regex does not match the ExampleLine, Regex:", logline.Regex, logline.Tag, logline.ExampleLine)
+		return false
+	}
+	for _, eleKey := range elementKeys {
+		ele, exists := logline.Elements[eleKey]
+		if !exists {
+			continue
+		}
+		if len(ele.StartPattern) > 0 || len(ele.Regex) > 0 {
+			fmt.Println("ElementKey is extracted by both the logline Regex and its ElementConfig, please provide only one of them", logline.Tag, eleKey, ele)
+			return false
+		}
+		// ElementConfig only provides the ColumnName and AllowEmpty for the regex group
+		ele.isRegexGroup = true
+	}
+	return true
+}
+
+// verifyElementType verifies the Type, Layout and OnTypeError of the element
+func verifyElementType(logline *LogLineConfig, eleKey string, ele *ElementConfig) bool {
+	if err := ele.verifyType(); err != nil {
+		fmt.Println("Invalid Type config,", err, logline.Tag, eleKey, ele)
+		return false
+	}
+	return true
+}
+
+// verifyExampleLineTypes verifies that the values of the typed elements found in the ExampleLine can be parsed into
+// their Types. It is called after verifying all the elements of the logline as it extracts all the values.
+func verifyExampleLineTypes(logline *LogLineConfig) bool {
+	values, err := logline.extractValues(logline.ExampleLine)
+	if err != nil {
+		fmt.Println("Value in ExampleLine cannot be parsed into its Type,", err, logline.Tag, logline.ExampleLine)
+		return false
+	}
+	for eleKey, filteredData := range values {
+		ele, exists := logline.Elements[eleKey]
+		if !exists || len(ele.Type) == 0 || filteredData.Text == NotFound || len(filteredData.Text) == 0 {
+			continue
+		}
+		if filteredData.Value == nil {
+			fmt.Println("Value in ExampleLine cannot be parsed into its Type,", logline.Tag, eleKey, ele.Type, filteredData.Text, logline.ExampleLine)
+			return false
+		}
+	}
+	return true
+}
+
+// verifyElementPosition verifies After and Occurrence of the element against the ExampleLine
+func verifyElementPosition(logline *LogLineConfig, eleKey string, ele *ElementConfig) bool {
+	if ele.Occurrence < 0 {
+		fmt.Println("Negative Occurrence is not supported", logline.Tag, eleKey, ele)
+		return false
+	}
+	if ele.Occurrence > 1 && ele.StartPattern == gStartOfLine {
+		fmt.Println("Occurrence is not supported with StartPattern '^'", logline.Tag, eleKey, ele)
+		return false
+	}
+	if len(ele.After) > 0 && !strings.Contains(logline.ExampleLine, ele.After) {
+		fmt.Println("After not found in ExampleLine, After:", ele.After, logline.Tag, eleKey, ele, logline.ExampleLine)
+		return false
+	}
+	if len(ele.After) == 0 && ele.Occurrence <= 1 {
+		return true
+	}
+	if err := ele.compileRegex(); err != nil {
+		fmt.Println("Cannot compile Regex of the ElementConfig", logline.Tag, eleKey, ele.Regex, err)
+		return false
+	}
+	if _, found := ele.extract(logline.ExampleLine); !found {
+		fmt.Println("Element not found in ExampleLine after applying After and Occurrence", logline.Tag, eleKey, ele, logline.ExampleLine)
+		return false
+	}
+	return true
+}
+
+func verifyElementRegex(logline *LogLineConfig, eleKey string, ele *ElementConfig) bool {
+	if len(ele.StartPattern) > 0 || len(ele.EndPattern) > 0 || ele.PatternLength > 0 {
+		fmt.Println("Either provide Regex or StartPattern, EndPattern and PatternLength, simulaneously both are not supported", logline.Tag, eleKey, ele)
+		return false
+	}
+	if err := ele.compileRegex(); err != nil {
+		fmt.Println("Cannot compile Regex of the ElementConfig", logline.Tag, eleKey, ele.Regex, err)
+		return false
+	}
+	if _, found := ele.extract(logline.ExampleLine); !found {
+		fmt.Println("Regex does not match the ExampleLine, Regex:", ele.Regex, logline.Tag, eleKey, logline.ExampleLine)
+		return false
+	}
+	return true
+}
+
 func (config *Config) readAndStoreSortedElementKeys(absConfigFile string, absAnchorFiles []string) bool {
 	reader, err := filesystem.Open(absConfigFile)
 	errorutils.PanicOnErr(err)
@@ -235,7 +458,7 @@ func (config *Config) readAndStoreSortedElementKeys(absConfigFile string, absAnc
 			return false
 		}
 		app.ClientConfig = &ClientConfigType{AppName: app.AppName}
-		elementKeys := map[string]bool{}
+		elementKeys := map[string]*MetaInfoType{}
 		for j, tempLogLineConfig := range tempApp.LogLines {
 			loglineConfig := app.LogLines[j]
 			if loglineConfig.Tag != tempLogLineConfig.Tag {
@@ -254,13 +477,93 @@ func (config *Config) readAndStoreSortedElementKeys(absConfigFile string, absAnc
 					fmt.Println("ERROR:", "Cannot find elementKey in actual config Element map after reading again the config", eleKey, elements)
 					return false
 				}
+				if metaInfo, alreadyExists := elementKeys[eleKey]; alreadyExists {
+					if metaInfo.Type != element.Type || metaInfo.Layout != element.Layout {
+						fmt.Println("ERROR:", "Type of an ElementKey should be same in all the loglines", app.AppName, eleKey, metaInfo.Type, element.Type)
+						return false
+					}
+					continue
+				}
+				metaInfo := &MetaInfoType{ElementKey: eleKey, ColumnName: element.ColumnName, Type: element.Type, Layout: element.Layout}
+				app.ClientConfig.MetaInfo = append(app.ClientConfig.MetaInfo, metaInfo)
+				elementKeys[eleKey] = metaInfo
+			}
+			// elements extracted by the logline Regex which are not given in Elements config
+			for _, eleKey := range loglineConfig.regexElementKeys() {
 				if _, alreadyExists := elementKeys[eleKey]; alreadyExists {
 					continue
 				}
-				app.ClientConfig.MetaInfo = append(app.ClientConfig.MetaInfo, &MetaInfoType{ElementKey: eleKey, ColumnName: element.ColumnName})
-				elementKeys[eleKey] = true
+				metaInfo := &MetaInfoType{ElementKey: eleKey}
+				app.ClientConfig.MetaInfo = append(app.ClientConfig.MetaInfo, metaInfo)
+				elementKeys[eleKey] = metaInfo
+			}
+		}
+		if !app.verifyComputedColumns() {
+			return false
+		}
+		if !app.verifyDeltaColumns() {
+			return false
+		}
+		if !app.selectOutputElements() {
+			return false
+		}
+		if !app.verifyWhere() {
+			return false
+		}
+		if !app.verifyFillForward() {
+			return false
+		}
+	}
+	return true
+}
+
+// selectOutputElements keeps only the OutputElements in the MetaInfo of the ClientConfig in the given order
+func (appconfig *AppConfig) selectOutputElements() bool {
+	appconfig.metaInfo = appconfig.ClientConfig.MetaInfo
+	if len(appconfig.OutputElements) == 0 {
+		return true
+	}
+	metaInfoMap := map[string]*MetaInfoType{}
+	for _, metaInfo := range appconfig.metaInfo {
+		metaInfoMap[metaInfo.ElementKey] = metaInfo
+	}
+
+	included := []string{}
+	excluded := map[string]bool{}
+	for _, eleKey := range appconfig.OutputElements {
+		isExcluded := strings.HasPrefix(eleKey, "-")
+		eleKey = strings.TrimPrefix(eleKey, "-")
+		if _, exists := metaInfoMap[eleKey]; !exists {
+			fmt.Println("OutputElements contains an ElementKey which is not present in any LogLine or ComputedColumns", appconfig.AppName, eleKey)
+			return false
+		}
+		if isExcluded {
+			excluded[eleKey] = true
+			continue
+		}
+		if findutils.ContainsString(included, eleKey) {
+			fmt.Println("Repeated ElementKey in OutputElements", appconfig.AppName, eleKey)
+			return false
+		}
+		included = append(included, eleKey)
+	}
+	if len(included) > 0 && len(excluded) > 0 {
+		fmt.Println("Either list the OutputElements or exclude them using '-', simultaneously both are not supported", appconfig.AppName, appconfig.OutputElements)
+		return false
+	}
+
+	outputMetaInfo := []*MetaInfoType{}
+	if len(included) > 0 {
+		for _, eleKey := range included {
+			outputMetaInfo = append(outputMetaInfo, metaInfoMap[eleKey])
+		}
+	} else {
+		for _, metaInfo := range appconfig.metaInfo {
+			if !excluded[metaInfo.ElementKey] {
+				outputMetaInfo = append(outputMetaInfo, metaInfo)
 			}
 		}
 	}
+	appconfig.ClientConfig.MetaInfo = outputMetaInfo
 	return true
 }
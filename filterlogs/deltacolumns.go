@@ -0,0 +1,237 @@
+package filterlogs
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parmaanu/goutils/findutils"
+)
+
+// Units of the delta columns
+const (
+	gDeltaDiff     = "diff"     // difference of the values, e.g. change in netPosition
+	gDeltaDuration = "duration" // duration between the timestamps
+	gDeltaRate     = "rate"     // difference of the values per second
+)
+
+var gDeltaUnits = []string{gDeltaDiff, gDeltaDuration, gDeltaRate}
+
+// DeltaColumnConfig stores the config of a column which is the change of a value since the previous record of the
+// app, e.g. time since the previous ORDER NEW of the same securityId. Records are compared in the order of the input
+// before applying the Where clauses of the app, so the delta columns can be used in Where.
+type DeltaColumnConfig struct {
+	ElementKey string `yaml:"ElementKey"`
+	ColumnName string `yaml:"ColumnName"`
+	// Of is the element key or column name whose value is compared with the previous record, it can be a computed
+	// column
+	Of string `yaml:"Of"`
+	// PartitionBy is the element key or column name whose value selects the previous record, e.g. securityId. All the
+	// records are compared with the previous record if it is empty.
+	PartitionBy string `yaml:"PartitionBy"`
+	// Unit is diff (default), duration or rate. diff is the difference of the numbers or durations, duration is the
+	// time between the timestamps and rate is the difference per second between the Timestamp of the records.
+	Unit string `yaml:"Unit"`
+	// Timestamp is the element key or column name of Type timestamp used by rate, default is TimestampElement of the
+	// app
+	Timestamp string `yaml:"Timestamp"`
+	// Tags selects the records compared by the column, the column is N/A for the records of the other tags. All the
+	// records are compared if it is empty.
+	Tags []string `yaml:"Tags"`
+
+	of, partitionBy, timestamp string // element keys
+	metaInfo                   *MetaInfoType
+	previous                   map[string]*deltaRecord // key is the value of PartitionBy
+}
+
+// deltaRecord is the previous record of a partition
+type deltaRecord struct {
+	value     *FilteredData
+	timestamp time.Time
+}
+
+// verifyDeltaColumns verifies the DeltaColumns of the app and appends them to the MetaInfo. It is called after adding
+// the computed columns to the MetaInfo.
+func (appconfig *AppConfig) verifyDeltaColumns() bool {
+	for _, dc := range appconfig.DeltaColumns {
+		if err := dc.verify(appconfig); err != nil {
+			fmt.Println("Invalid DeltaColumns config,", err, appconfig.AppName, dc.ElementKey)
+			return false
+		}
+		appconfig.ClientConfig.MetaInfo = append(appconfig.ClientConfig.MetaInfo, dc.metaInfo)
+	}
+	return true
+}
+
+func (dc *DeltaColumnConfig) verify(appconfig *AppConfig) error {
+	if len(dc.ElementKey) == 0 || len(dc.Of) == 0 {
+		return fmt.Errorf("please provide ElementKey and Of, e.g. {ElementKey: NetPositionChangeKey, Of: netPosition}")
+	}
+	metaInfos := appconfig.ClientConfig.MetaInfo
+	findMetaInfo := func(column string) *MetaInfoType {
+		for _, metaInfo := range metaInfos {
+			if metaInfo.ElementKey == column || metaInfo.ColumnName == column {
+				return metaInfo
+			}
+		}
+		return nil
+	}
+	if findMetaInfo(dc.ElementKey) != nil {
+		return fmt.Errorf("ElementKey is already used, please provide a unique ElementKey")
+	}
+	if len(dc.Unit) == 0 {
+		dc.Unit = gDeltaDiff
+	}
+	if !findutils.ContainsString(gDeltaUnits, dc.Unit) {
+		return fmt.Errorf("unknown Unit %q, supported units are %s", dc.Unit, strings.Join(gDeltaUnits, ", "))
+	}
+	of := findMetaInfo(dc.Of)
+	if of == nil {
+		return fmt.Errorf("unknown element %q in Of", dc.Of)
+	}
+	dc.of = of.ElementKey
+	if len(dc.PartitionBy) > 0 {
+		partitionBy := findMetaInfo(dc.PartitionBy)
+		if partitionBy == nil {
+			return fmt.Errorf("unknown element %q in PartitionBy", dc.PartitionBy)
+		}
+		dc.partitionBy = partitionBy.ElementKey
+	}
+
+	dc.metaInfo = &MetaInfoType{ElementKey: dc.ElementKey, ColumnName: dc.ColumnName, Type: TypeFloat}
+	switch dc.Unit {
+	case gDeltaDiff:
+		switch of.Type {
+		case TypeTimestamp:
+			return fmt.Errorf("please use Unit %s for the timestamp %s", gDeltaDuration, dc.Of)
+		case TypeInt, TypeDuration:
+			dc.metaInfo.Type = of.Type
+		}
+	case gDeltaDuration:
+		if of.Type != TypeTimestamp {
+			return fmt.Errorf("Unit %s needs %s of Type %s", gDeltaDuration, dc.Of, TypeTimestamp)
+		}
+		dc.metaInfo.Type = TypeDuration
+	case gDeltaRate:
+		timestamp := dc.Timestamp
+		if len(timestamp) == 0 {
+			timestamp = appconfig.TimestampElement
+		}
+		if len(timestamp) == 0 {
+			return fmt.Errorf("please provide Timestamp or TimestampElement of the app for Unit %s", gDeltaRate)
+		}
+		ts := findMetaInfo(timestamp)
+		if ts == nil || ts.Type != TypeTimestamp {
+			return fmt.Errorf("Timestamp %s should be an element of Type %s", timestamp, TypeTimestamp)
+		}
+		dc.timestamp = ts.ElementKey
+	}
+	dc.previous = map[string]*deltaRecord{}
+	return nil
+}
+
+// deltaNumber returns the number used by diff and rate, durations are in nanoseconds
+func deltaNumber(filteredData *FilteredData) (float64, bool) {
+	switch value := filteredData.Value.(type) {
+	case int64:
+		return float64(value), true
+	case float64:
+		return value, true
+	case *big.Rat:
+		f, _ := value.Float64()
+		return f, true
+	case time.Duration:
+		return float64(value), true
+	case bool, time.Time:
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(filteredData.Text, 64)
+	return f, err == nil
+}
+
+// delta returns the change from the previous record, false is returned if it cannot be calculated
+func (dc *DeltaColumnConfig) delta(current, previous *deltaRecord) (*FilteredData, bool) {
+	switch dc.Unit {
+	case gDeltaDuration:
+		t1, ok1 := previous.value.Value.(time.Time)
+		t2, ok2 := current.value.Value.(time.Time)
+		if !ok1 || !ok2 {
+			return nil, false
+		}
+		d := t2.Sub(t1)
+		return &FilteredData{Text: d.String(), Value: d}, true
+	}
+	v1, ok1 := deltaNumber(previous.value)
+	v2, ok2 := deltaNumber(current.value)
+	if !ok1 || !ok2 {
+		return nil, false
+	}
+	if dc.Unit == gDeltaRate {
+		seconds := current.timestamp.Sub(previous.timestamp).Seconds()
+		if seconds <= 0 {
+			return nil, false
+		}
+		rate := (v2 - v1) / seconds
+		return &FilteredData{Text: strconv.FormatFloat(rate, 'f', -1, 64), Value: rate}, true
+	}
+	switch dc.metaInfo.Type {
+	case TypeInt:
+		// ints are subtracted as ints to avoid the rounding of large numbers
+		i1, ok1 := previous.value.Value.(int64)
+		i2, ok2 := current.value.Value.(int64)
+		if !ok1 || !ok2 {
+			return nil, false
+		}
+		return &FilteredData{Text: strconv.FormatInt(i2-i1, 10), Value: i2 - i1}, true
+	case TypeDuration:
+		// durations are also subtracted as ints
+		d1, ok1 := previous.value.Value.(time.Duration)
+		d2, ok2 := current.value.Value.(time.Duration)
+		if !ok1 || !ok2 {
+			return nil, false
+		}
+		return &FilteredData{Text: (d2 - d1).String(), Value: d2 - d1}, true
+	}
+	diff := v2 - v1
+	return &FilteredData{Text: strconv.FormatFloat(diff, 'f', -1, 64), Value: diff}, true
+}
+
+// computeDeltaColumns adds the DeltaColumns of the app to the values of the record. A column is not added (N/A) for the
+// first record of a partition, for the records of the other Tags and if the values cannot be compared.
+func (appconfig *AppConfig) computeDeltaColumns(tag string, values map[string]*FilteredData) {
+	for _, dc := range appconfig.DeltaColumns {
+		if len(dc.Tags) > 0 && !findutils.ContainsString(dc.Tags, tag) {
+			continue
+		}
+		value := values[dc.of]
+		if isNotFound(value) {
+			continue
+		}
+		current := &deltaRecord{value: value}
+		if len(dc.timestamp) > 0 {
+			ts, found := values[dc.timestamp]
+			if !found || ts == nil {
+				continue
+			}
+			if current.timestamp, found = ts.Value.(time.Time); !found {
+				continue
+			}
+		}
+		partition := ""
+		if len(dc.partitionBy) > 0 {
+			partitionValue := values[dc.partitionBy]
+			if isNotFound(partitionValue) {
+				continue
+			}
+			partition = partitionValue.Text
+		}
+		if previous, exists := dc.previous[partition]; exists {
+			if filteredData, ok := dc.delta(current, previous); ok {
+				values[dc.ElementKey] = filteredData
+			}
+		}
+		dc.previous[partition] = current
+	}
+}
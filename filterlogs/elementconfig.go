@@ -2,11 +2,41 @@ package filterlogs
 
 import (
 	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/manifoldco/promptui"
 )
 
+// Types of the elements, parsed value of the element is stored in FilteredData.Value
+const (
+	TypeInt       = "int"       // int64
+	TypeFloat     = "float"     // float64
+	TypeDecimal   = "decimal"   // *big.Rat, exact decimal numbers like prices
+	TypeBool      = "bool"      // bool
+	TypeDuration  = "duration"  // time.Duration, e.g. 1h2m0.5s
+	TypeTimestamp = "timestamp" // time.Time, parsed using Layout
+)
+
+// NotFound is the text of an element which is not found in the logline
+const NotFound = "N/F"
+
+// isNotFound returns true if the element is not found in the record
+func isNotFound(filteredData *FilteredData) bool {
+	return filteredData == nil || filteredData.Text == NotFound
+}
+
+// Policies for the values which cannot be parsed into the Type of the element
+const (
+	gOnTypeErrorKeep  = "keep"   // keep the raw text, it is the default
+	gOnTypeErrorNF    = NotFound // replace the value with N/F
+	gOnTypeErrorDrop  = "drop"   // drop the record
+	gOnTypeErrorAbort = "abort"  // stop processing the input
+)
+
 // ElementConfig store the config for each pattern in a line
 type ElementConfig struct {
 	ColumnName    string `yaml:"ColumnName"`
@@ -14,8 +44,28 @@ type ElementConfig struct {
 	EndPattern    string `yaml:"EndPattern"`
 	AllowEmpty    bool   `yaml:"AllowEmpty"` // When this is set as true then empty values does not print N/F for this column
 	PatternLength int    `yaml:"PatternLength"`
-	After         string `yaml:"After"`
+	// After moves the start of the search for the element after the first occurrence of this pattern in the line
+	After string `yaml:"After"`
+	// Occurrence picks the nth occurrence of StartPattern (or Regex) after the start of the search, default is 1
+	Occurrence int `yaml:"Occurrence"`
+	// Regex extracts the first capturing group (or the full match if there is no group) as the value of the element.
+	// It cannot be used along with StartPattern, EndPattern and PatternLength.
+	Regex string `yaml:"Regex"`
+	// Type is one of int, float, decimal, bool, duration or timestamp. Layout is required for timestamp and it follows
+	// the reference time of golang's time package, e.g. '2006-01-02 15:04:05.000000'
+	Type   string `yaml:"Type"`
+	Layout string `yaml:"Layout"`
+	// OnTypeError is the policy for the values which cannot be parsed into the Type: keep (default), N/F, drop or abort
+	OnTypeError string `yaml:"OnTypeError"`
+	// FillForward fills the records of the app in which the element is not found with its last seen value, e.g. a
+	// session id which is logged once and applies to the later loglines
+	FillForward bool `yaml:"FillForward"`
+	// FillForwardBy is the element key which scopes the last seen value of a FillForward element, e.g. the last
+	// strategy of each securityId
+	FillForwardBy string `yaml:"FillForwardBy"`
 
+	regex                *regexp.Regexp
+	isRegexGroup         bool // element is extracted by a named group of the LogLine Regex
 	cacheFormattedConfig string
 }
 
@@ -30,13 +80,198 @@ func (ele *ElementConfig) Formatted() string {
 	if len(ele.ColumnName) > 0 {
 		output = append(output, fmt.Sprintf("%s: %-23s", blue("ColName"), ele.ColumnName))
 	}
-	output = append(output, fmt.Sprintf("%s: %-23s", blue("Start"), "'"+ele.StartPattern+"'"))
+	if ele.isRegexGroup {
+		output = append(output, blue("LogLine Regex group"))
+	} else if len(ele.Regex) > 0 {
+		output = append(output, fmt.Sprintf("%s: %s", blue("Regex"), "'"+ele.Regex+"'"))
+	} else {
+		output = append(output, fmt.Sprintf("%s: %-23s", blue("Start"), "'"+ele.StartPattern+"'"))
+	}
 	if len(ele.EndPattern) > 0 {
 		output = append(output, fmt.Sprintf("%s: %s", blue("End"), "'"+ele.EndPattern+"'"))
 	}
 	if ele.PatternLength > 0 {
 		output = append(output, fmt.Sprintf("%s: %d", blue("Len"), ele.PatternLength))
 	}
+	if len(ele.After) > 0 {
+		output = append(output, fmt.Sprintf("%s: %s", blue("After"), "'"+ele.After+"'"))
+	}
+	if len(ele.Type) > 0 {
+		output = append(output, fmt.Sprintf("%s: %s", blue("Type"), ele.Type))
+	}
+	if ele.Occurrence > 1 {
+		output = append(output, fmt.Sprintf("%s: %d", blue("Occurrence"), ele.Occurrence))
+	}
 	ele.cacheFormattedConfig = strings.Join(output, " ")
 	return ele.cacheFormattedConfig
 }
+
+// locate finds the element in the line and returns its indexes in the line. line[matchStart:valueStart] is the
+// StartPattern, line[valueStart:valueEnd] is the value of the element and line[valueEnd:matchEnd] is the EndPattern.
+// found is false if the element is not present in the line.
+func (ele *ElementConfig) locate(line string) (matchStart, valueStart, valueEnd, matchEnd int, found bool) {
+	searchFrom := 0
+	if len(ele.After) > 0 {
+		idx := strings.Index(line, ele.After)
+		// return if After is not found
+		if idx < 0 {
+			return
+		}
+		searchFrom = idx + len(ele.After)
+	}
+	if ele.regex != nil {
+		return ele.locateRegex(line, searchFrom)
+	}
+
+	startPat := ele.StartPattern
+	if startPat == gStartOfLine {
+		startPat = ""
+		matchStart = searchFrom
+	} else {
+		matchStart = indexOfOccurrence(line, startPat, searchFrom, ele.occurrence())
+	}
+	// return if the StartPattern is not found
+	if matchStart < 0 {
+		return
+	}
+	valueStart = matchStart + len(startPat)
+	valueEnd = valueStart
+	matchEnd = valueStart
+
+	if len(ele.EndPattern) > 0 {
+		valueEnd = len(line)
+		matchEnd = len(line)
+		if ele.EndPattern != gEndOfLine {
+			idx := strings.Index(line[valueStart:], ele.EndPattern)
+			// return if EndPattern is not found
+			if idx < 0 {
+				return
+			}
+			valueEnd = valueStart + idx
+			matchEnd = valueEnd + len(ele.EndPattern)
+		}
+	} else if ele.PatternLength > 0 {
+		// return if PatternLength is more than the length of the line
+		if valueStart+ele.PatternLength > len(line) {
+			return
+		}
+		valueEnd = valueStart + ele.PatternLength
+		matchEnd = valueEnd
+	}
+	found = true
+	return
+}
+
+func (ele *ElementConfig) locateRegex(line string, searchFrom int) (matchStart, valueStart, valueEnd, matchEnd int, found bool) {
+	matches := ele.regex.FindAllStringSubmatchIndex(line[searchFrom:], ele.occurrence())
+	if len(matches) < ele.occurrence() {
+		return
+	}
+	loc := matches[len(matches)-1]
+	matchStart, matchEnd = searchFrom+loc[0], searchFrom+loc[1]
+	valueStart, valueEnd = matchStart, matchEnd
+	if len(loc) > 2 {
+		// return if the first capturing group is not matched
+		if loc[2] < 0 {
+			return
+		}
+		valueStart, valueEnd = searchFrom+loc[2], searchFrom+loc[3]
+	}
+	found = true
+	return
+}
+
+func (ele *ElementConfig) occurrence() int {
+	if ele.Occurrence <= 0 {
+		return 1
+	}
+	return ele.Occurrence
+}
+
+// indexOfOccurrence returns the index of the nth non-overlapping occurrence of pattern in the line starting from
+// searchFrom, -1 is returned if there are less than n occurrences
+func indexOfOccurrence(line, pattern string, searchFrom, n int) int {
+	idx := -1
+	for i := 0; i < n; i++ {
+		found := strings.Index(line[searchFrom:], pattern)
+		if found < 0 {
+			return -1
+		}
+		idx = searchFrom + found
+		searchFrom = idx + len(pattern)
+	}
+	return idx
+}
+
+// compileRegex compiles the Regex of the element, nothing is done if Regex is not provided
+func (ele *ElementConfig) compileRegex() error {
+	if len(ele.Regex) == 0 || ele.regex != nil {
+		return nil
+	}
+	regex, err := regexp.Compile(ele.Regex)
+	if err != nil {
+		return err
+	}
+	ele.regex = regex
+	return nil
+}
+
+// extract returns the value of the element from the line, false is returned if the element is not found
+func (ele *ElementConfig) extract(line string) (string, bool) {
+	_, valueStart, valueEnd, _, found := ele.locate(line)
+	if !found {
+		return "", false
+	}
+	return line[valueStart:valueEnd], true
+}
+
+// parseValue converts the text into the Type of the element, nil is returned if the Type is not provided
+func (ele *ElementConfig) parseValue(text string) (interface{}, error) {
+	switch ele.Type {
+	case "":
+		return nil, nil
+	case TypeInt:
+		return strconv.ParseInt(text, 10, 64)
+	case TypeFloat:
+		return strconv.ParseFloat(text, 64)
+	case TypeDecimal:
+		value, ok := new(big.Rat).SetString(text)
+		if !ok {
+			return nil, fmt.Errorf("cannot parse %q as decimal", text)
+		}
+		return value, nil
+	case TypeBool:
+		return strconv.ParseBool(text)
+	case TypeDuration:
+		return time.ParseDuration(text)
+	case TypeTimestamp:
+		return time.Parse(ele.Layout, text)
+	}
+	return nil, fmt.Errorf("unknown Type %q", ele.Type)
+}
+
+func (ele *ElementConfig) verifyType() error {
+	switch ele.Type {
+	case "", TypeInt, TypeFloat, TypeDecimal, TypeBool, TypeDuration:
+		if len(ele.Layout) > 0 {
+			return fmt.Errorf("Layout is supported only with Type %s", TypeTimestamp)
+		}
+	case TypeTimestamp:
+		if len(ele.Layout) == 0 {
+			return fmt.Errorf("please provide Layout for Type %s, e.g. '2006-01-02 15:04:05.000000'", TypeTimestamp)
+		}
+	default:
+		return fmt.Errorf("unknown Type %q, supported types are %s", ele.Type,
+			strings.Join([]string{TypeInt, TypeFloat, TypeDecimal, TypeBool, TypeDuration, TypeTimestamp}, ", "))
+	}
+	switch ele.OnTypeError {
+	case "", gOnTypeErrorKeep, gOnTypeErrorNF, gOnTypeErrorDrop, gOnTypeErrorAbort:
+	default:
+		return fmt.Errorf("unknown OnTypeError %q, supported policies are %s", ele.OnTypeError,
+			strings.Join([]string{gOnTypeErrorKeep, gOnTypeErrorNF, gOnTypeErrorDrop, gOnTypeErrorAbort}, ", "))
+	}
+	if len(ele.OnTypeError) > 0 && len(ele.Type) == 0 {
+		return fmt.Errorf("OnTypeError is supported only with Type")
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package filterlogs
+
+import "fmt"
+
+// fillForwardState keeps the last seen values of the FillForward elements of an app
+type fillForwardState struct {
+	// scopeKeys are the FillForwardBy of each FillForward element, key is element key. Scope key is empty if the
+	// last value is shared by all the records.
+	scopeKeys map[string]string
+	// lastValues are the last seen values, key is element key and then the value of its scope key
+	lastValues map[string]map[string]*FilteredData
+}
+
+// verifyFillForward finds the FillForward elements of the app. An element is FillForward if it is set in any of its
+// loglines, FillForwardBy must be same in all of them.
+func (appconfig *AppConfig) verifyFillForward() bool {
+	scopeKeys := map[string]string{}
+	for _, logline := range appconfig.LogLines {
+		for eleKey, ele := range logline.Elements {
+			if !ele.FillForward {
+				if len(ele.FillForwardBy) > 0 {
+					fmt.Println("FillForwardBy can only be given with FillForward", appconfig.AppName, logline.Tag, eleKey)
+					return false
+				}
+				continue
+			}
+			if scopeKey, exists := scopeKeys[eleKey]; exists && scopeKey != ele.FillForwardBy {
+				fmt.Println("FillForwardBy of an ElementKey should be same in all the loglines", appconfig.AppName, eleKey,
+					scopeKey, ele.FillForwardBy)
+				return false
+			}
+			if ele.FillForwardBy == eleKey {
+				fmt.Println("FillForwardBy cannot be the element itself", appconfig.AppName, logline.Tag, eleKey)
+				return false
+			}
+			scopeKeys[eleKey] = ele.FillForwardBy
+		}
+	}
+	if len(scopeKeys) == 0 {
+		return true
+	}
+	// computed columns cannot be the scope key as they are computed after filling the elements
+	knownKeys := map[string]bool{}
+	for _, logline := range appconfig.LogLines {
+		for eleKey := range logline.Elements {
+			knownKeys[eleKey] = true
+		}
+		for _, eleKey := range logline.regexElementKeys() {
+			knownKeys[eleKey] = true
+		}
+	}
+	for eleKey, scopeKey := range scopeKeys {
+		if len(scopeKey) > 0 && !knownKeys[scopeKey] {
+			fmt.Println("FillForwardBy is not an ElementKey of the app", appconfig.AppName, eleKey, scopeKey)
+			return false
+		}
+	}
+	appconfig.fillState = &fillForwardState{scopeKeys: scopeKeys, lastValues: map[string]map[string]*FilteredData{}}
+	return true
+}
+
+// fillForward remembers the values of the FillForward elements found in the record and fills the missing ones with
+// their last seen values. A scoped element is filled only if the record has the value of its scope key.
+func (appconfig *AppConfig) fillForward(values map[string]*FilteredData) {
+	state := appconfig.fillState
+	if state == nil {
+		return
+	}
+	// unscoped elements are filled first as they can be the scope key of the other elements
+	for _, scoped := range []bool{false, true} {
+		for eleKey, scopeKey := range state.scopeKeys {
+			if scoped == (len(scopeKey) > 0) {
+				state.fill(values, eleKey, scopeKey)
+			}
+		}
+	}
+}
+
+// fill remembers or fills the value of an element
+func (state *fillForwardState) fill(values map[string]*FilteredData, eleKey, scopeKey string) {
+	scope := ""
+	if len(scopeKey) > 0 {
+		scopeValue := values[scopeKey]
+		if isNotFound(scopeValue) {
+			return
+		}
+		scope = scopeValue.Text
+	}
+	if filteredData := values[eleKey]; !isNotFound(filteredData) {
+		if state.lastValues[eleKey] == nil {
+			state.lastValues[eleKey] = map[string]*FilteredData{}
+		}
+		state.lastValues[eleKey][scope] = filteredData
+		return
+	}
+	if lastValue, exists := state.lastValues[eleKey][scope]; exists {
+		values[eleKey] = lastValue
+	}
+}
@@ -2,10 +2,11 @@ package filterlogs
 
 import (
 	"fmt"
-	"strings"
+	"io"
+	"os"
+	"sync"
 	"tocsv/logparser"
 
-	"github.com/parmaanu/goutils/algoutils"
 	"github.com/parmaanu/goutils/fileutils"
 )
 
@@ -14,11 +15,11 @@ import (
 // //	 the logfile. This will make number of output columns smaller
 // // - Create a config generate from logs
 // // - Create a tui to select output flags or columns
-// // - Use goevaluate to add a calculated columns
+// // - Use goevaluate to add a calculated columns [DONE]
 // // - Show log patterns and log line examples quickly using an interactive menu [DONE]
-// // - Tail logs for a pattern
+// // - Tail logs for a pattern [DONE]
 // // - Support `After` in log line pattern config to pick up other patterns when there are multiple matching patterns
-// in single line
+// in single line [DONE]
 //
 // // TODO, golang
 // // - create template for creating golang apps
@@ -27,11 +28,15 @@ import (
 const (
 	gStartOfLine = "^"
 	gEndOfLine   = "$"
+
+	// StdinInput is the name of the input file which reads the loglines from stdin
+	StdinInput = "-"
 )
 
 // FilteredData store the config for each extracted value
 type FilteredData struct {
-	Text string
+	Text  string
+	Value interface{} // Text parsed into the Type of the element, nil if Type is not provided or parsing fails
 }
 
 // ClientCallbackType is the type of the function that is called when we get some filtered data
@@ -39,97 +44,114 @@ type ClientCallbackType func(*ClientConfigType, map[string]*FilteredData)
 
 // App is a struct which converts a logfile into a csv
 type App struct {
-	inputFile   string
-	configFile  string
-	anchorFiles []string
-	interactive bool
-
-	// header    []string
-	clientValuesMap map[string]*FilteredData
-	clientCallback  ClientCallbackType
+	inputFiles   []string
+	inputReaders []io.Reader
+	configFile   string
+	anchorFiles  []string
+	interactive  bool
+	follow       bool
+	since, until string
+	where        string
+	keepApps     bool // keep the records of the apps which do not have the elements used in where
+
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	clientCallback ClientCallbackType
+	blockTrackers  map[*AppConfig]*blockTracker
+	err            error
+
+	config       *Config
+	configLoaded bool
 }
 
 // NewApp returns an instance of to csv app
 func NewApp(inputFiles []string, configFile string, anchorFiles []string, interactiveMode bool) *App {
 	return &App{
-		// TODO, add a support of multiple input log files later on - need to enhance logparser to read multiple
-		// logfiles in sorted order
-		inputFile:   inputFiles[0],
+		inputFiles:  inputFiles,
 		configFile:  configFile,
 		anchorFiles: anchorFiles,
 		interactive: interactiveMode,
 
-		clientValuesMap: make(map[string]*FilteredData),
+		stop:          make(chan struct{}),
+		blockTrackers: make(map[*AppConfig]*blockTracker),
 	}
 }
 
-func (app *App) processStartAndEndBlocks(line string, appconfig *AppConfig) {
-	if !appconfig.hasStartBlockPattern && !appconfig.hasEndBlockPattern {
-		app.clientValuesMap = make(map[string]*FilteredData)
-		return
-	}
-	// TODO, implement start pattern and end pattern logic
-	// TODO, reset valuesMap on start and end Blocks
+// AddInputReaders adds io.Readers as the sources of loglines along with the input files
+func (app *App) AddInputReaders(readers ...io.Reader) {
+	app.inputReaders = append(app.inputReaders, readers...)
 }
 
-func (app *App) filterData(line string, appconfig *AppConfig, logconfig *LogLineConfig) {
+// SetFollowMode sets the follow mode, in this mode input files are followed as they grow (including truncation and
+// rotation of the files) and Run returns only after Stop is called
+func (app *App) SetFollowMode(follow bool) {
+	app.follow = follow
+}
 
-	elementsFound := false
-	app.processStartAndEndBlocks(line, appconfig)
+// SetTimeRange keeps only the records whose timestamp is in [since, until), it overrides Since and Until given in the
+// config. Empty since or until is not overridden.
+func (app *App) SetTimeRange(since, until string) {
+	app.since = since
+	app.until = until
+}
 
-	for elementKey, ele := range logconfig.Elements {
-		text := ""
+// SetWhere keeps only the records for which the expression is true, e.g. "side == 'BUY' && quantity > 500". It is
+// applied along with the Where of the config to the apps which have all the elements used in the expression.
+func (app *App) SetWhere(where string) {
+	app.where = where
+}
 
-		startPat := ele.StartPattern
-		startIdx := 0
-		if startPat == gStartOfLine {
-			startPat = ""
-			startIdx = 0
-		} else {
-			startIdx = strings.Index(line, startPat)
-		}
-		// continue if the StartPattern is not found
-		if startIdx < 0 {
-			continue
-		}
+// SetWhereKeepOtherApps keeps the records of the apps which do not have all the elements used in the expression of
+// SetWhere, by default their records are dropped
+func (app *App) SetWhereKeepOtherApps(keep bool) {
+	app.keepApps = keep
+}
 
-		if len(ele.EndPattern) > 0 {
-			endPat := ""
-			endIdx := len(line)
-			if ele.EndPattern != gEndOfLine {
-				endPat = ele.EndPattern
-				idx := strings.Index(line[startIdx+len(startPat):], endPat)
-				// continue if EndPattern is not found
-				if idx < 0 {
-					continue
-				}
-				endIdx = startIdx + len(startPat) + idx
-			}
-			text = line[startIdx+len(startPat) : endIdx]
-		} else if ele.PatternLength > 0 {
-			if ele.PatternLength >= len(line) {
-				// return if PatternLength is more than the length of the line
-				// TODO, write testcases for this
-				continue
-			}
-			endIdx := startIdx + len(startPat) + ele.PatternLength
-			text = line[startIdx+len(startPat) : endIdx]
-		}
+// LoadConfig reads and verifies the config file, it is read only once and the same config is used by Run. Clients can
+// call it before Run to verify their own config against the apps. It returns nil if the config is invalid.
+func (app *App) LoadConfig() *Config {
+	if !app.configLoaded {
+		app.config = NewConfig(app.configFile, app.anchorFiles)
+		app.configLoaded = true
+	}
+	return app.config
+}
+
+// Stop stops the processing of input files, it is safe to call Stop from other goroutines
+func (app *App) Stop() {
+	app.stopOnce.Do(func() {
+		close(app.stop)
+	})
+}
 
-		if logconfig.TrimSpaces {
-			text = strings.TrimSpace(text)
+// filterData extracts the elements from the line and passes them to the client. logconfig is nil for the lines which
+// only match the StartBlockPattern or EndBlockPattern of the app.
+func (app *App) filterData(line string, info logparser.LineInfo, appconfig *AppConfig, logconfig *LogLineConfig) {
+	// lines read after aborting are ignored until the logparser is stopped
+	if app.err != nil || appconfig.droppedByWhere {
+		return
+	}
+	tag := ""
+	values := map[string]*FilteredData{}
+	if logconfig != nil {
+		tag = logconfig.Tag
+		var err error
+		values, err = logconfig.extractValues(line)
+		if err != nil {
+			if tErr, ok := err.(*typeError); ok && tErr.policy == gOnTypeErrorAbort {
+				app.err = fmt.Errorf("%v, app: %s, tag: %s, line: %s", err, appconfig.AppName, tag, line)
+				fmt.Println("ERROR, aborting", app.err)
+				app.Stop()
+			}
+			return
 		}
-		if !ele.AllowEmpty && len(text) == 0 {
-			text = "N/F"
+		if !logconfig.matchesWhere(values) {
+			return
 		}
-		elementsFound = true
-		app.clientValuesMap[elementKey] = &FilteredData{Text: text}
-	}
-	if !elementsFound {
-		return
 	}
 
-	if app.interactive {
+	if app.interactive && len(values) > 0 {
 		// TODO, change this fmt to logger; In console application use stdout (no logfile); In test create logger for debugging
 		fmt.Println(logconfig.FormattedLine(line))
 		for _, ele := range logconfig.Elements {
@@ -137,18 +159,37 @@ func (app *App) filterData(line string, appconfig *AppConfig, logconfig *LogLine
 		}
 		fileutils.ReadStdin()
 	}
-	// TODO, Make seaprate interface for passing a static and dynamic configs to the clients
-	appconfig.ClientConfig.Tag = logconfig.Tag
 
-	if appconfig.hasEndBlockPattern {
-		// TODO, check if the end block pattern matches then write output csv values
-		// TODO, write a testcase
-		if algoutils.StringContainsAll(line, appconfig.EndBlockPattern) {
-			app.clientCallback(appconfig.ClientConfig, app.clientValuesMap)
-		}
-	} else {
-		app.clientCallback(appconfig.ClientConfig, app.clientValuesMap)
+	if bt, exists := app.blockTrackers[appconfig]; exists {
+		bt.processLine(line, info, tag, values)
+		return
+	}
+	if len(values) == 0 {
+		return
+	}
+
+	appconfig.fillForward(values)
+	if !appconfig.inTimeRange(values, line) {
+		return
 	}
+	appconfig.computeColumns(values)
+	appconfig.computeDeltaColumns(tag, values)
+	if !appconfig.matchesWhere(values) {
+		return
+	}
+	// TODO, Make seaprate interface for passing a static and dynamic configs to the clients
+	appconfig.ClientConfig.Tag = tag
+	appconfig.ClientConfig.Source = info.Source
+	appconfig.ClientConfig.LineNo = info.LineNo
+	appconfig.ClientConfig.Offset = info.Offset
+	appconfig.ClientConfig.LogLine = line
+	app.clientCallback(appconfig.ClientConfig, values)
+}
+
+// Err returns the error because of which the processing is aborted, e.g. a value cannot be parsed into the Type of
+// its element with OnTypeError abort
+func (app *App) Err() error {
+	return app.err
 }
 
 // Run starts the application
@@ -158,14 +199,48 @@ func (app *App) Run(clientCallback ClientCallbackType) {
 		return
 	}
 	app.clientCallback = clientCallback
-	config := NewConfig(app.configFile, app.anchorFiles)
+	config := app.LoadConfig()
 	if config == nil {
 		return
 	}
+	if len(app.since) > 0 || len(app.until) > 0 {
+		if len(app.since) > 0 {
+			config.Since = app.since
+		}
+		if len(app.until) > 0 {
+			config.Until = app.until
+		}
+		if !config.verifyTimeRange() {
+			return
+		}
+	}
+	if len(app.where) > 0 && !config.addWhere(app.where, app.keepApps) {
+		return
+	}
 
 	lpr := logparser.NewLogParser()
 
-	lpr.AddFileSources(app.inputFile)
+	if config.LineTimestamp != nil {
+		lpr.SetLessFunc(config.LineTimestamp.less)
+		if rangeFunc := config.lineRangeFunc(); rangeFunc != nil && !app.follow {
+			lpr.SetLineRangeFunc(rangeFunc)
+		}
+	}
+	inputFiles := []string{}
+	inputReaders := app.inputReaders
+	for _, inputFile := range app.inputFiles {
+		if inputFile == StdinInput {
+			inputReaders = append(inputReaders, os.Stdin)
+		} else {
+			inputFiles = append(inputFiles, inputFile)
+		}
+	}
+	if app.follow {
+		lpr.AddTailSources(inputFiles...)
+	} else {
+		lpr.AddFileSources(inputFiles...)
+	}
+	lpr.AddReaderSources(inputReaders...)
 
 	for _, appconfig := range config.Apps {
 		for _, logconfig := range appconfig.LogLines {
@@ -175,10 +250,48 @@ func (app *App) Run(clientCallback ClientCallbackType) {
 			lpr.AddConfig(logparser.Config{
 				Patterns: logConfigCopy.Patterns,
 				OnEachLineFunc: func(c *logparser.OnEachLineConfig) {
-					app.filterData(c.Line, appconfigCopy, logConfigCopy)
+					app.filterData(c.Line, c.Info, appconfigCopy, logConfigCopy)
 				},
 			})
 		}
 	}
+	// block patterns are added after all the loglines so that they only get the lines which are not matched by any
+	// logline config
+	for _, appconfig := range config.Apps {
+		if !appconfig.hasStartBlockPattern && !appconfig.hasEndBlockPattern {
+			continue
+		}
+		app.blockTrackers[appconfig] = newBlockTracker(appconfig, app.clientCallback, func() bool { return app.err != nil })
+		appconfigCopy := appconfig
+		for _, blockPattern := range [][]string{appconfig.StartBlockPattern, appconfig.EndBlockPattern} {
+			lpr.AddConfig(logparser.Config{
+				Patterns: blockPattern,
+				OnEachLineFunc: func(c *logparser.OnEachLineConfig) {
+					app.filterData(c.Line, c.Info, appconfigCopy, nil)
+				},
+			})
+		}
+	}
+
+	// stop the logparser when the app is stopped
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-app.stop:
+			lpr.Stop()
+		case <-done:
+		}
+	}()
 	lpr.Run()
+
+	// open blocks are incomplete after aborting
+	if app.err != nil {
+		return
+	}
+	for _, appconfig := range config.Apps {
+		if bt, exists := app.blockTrackers[appconfig]; exists {
+			bt.flush()
+		}
+	}
 }
@@ -2,9 +2,12 @@ package filterlogs_test
 
 import (
 	"io/ioutil"
+	"math/big"
 	"os"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 	"tocsv/filterlogs"
 
 	"github.com/parmaanu/goutils/filesystem"
@@ -55,13 +58,13 @@ func TestFilterLogsWithSingleApp(t *testing.T) {
 	interactiveMode := false
 
 	expectedFilteredData := map[string]*filterlogs.FilteredData{
-		"TimeStampKey":  {"2020-06-02 14:33:56.531063"},
-		"SecurityIdKey": {"999"},
-		"PriceKey":      {"123.123"},
-		"QuantityKey":   {"1000"},
-		"SideKey":       {"BUY"},
-		"BidKey":        {"124.0"},
-		"AskKey":        {"125.0"},
+		"TimeStampKey":  {Text: "2020-06-02 14:33:56.531063"},
+		"SecurityIdKey": {Text: "999"},
+		"PriceKey":      {Text: "123.123"},
+		"QuantityKey":   {Text: "1000"},
+		"SideKey":       {Text: "BUY"},
+		"BidKey":        {Text: "124.0"},
+		"AskKey":        {Text: "125.0"},
 	}
 
 	callbackCalled := false
@@ -77,3 +80,1000 @@ func TestFilterLogsWithSingleApp(t *testing.T) {
 	app.Run(callback)
 	assert.True(t, callbackCalled, "Assigned callback is not called. Please check the config.")
 }
+
+func Test_multiple_input_files_are_merged_in_chronological_order_using_LineTimestamp(t *testing.T) {
+	mfs := filesystem.GetFileSystem().(*filesystem.MockFileSystem)
+
+	// Note, dates are in DD/MM/YYYY format so lexicographical order of the lines is not the chronological order
+	mfs.SetFileData("orders.log", []string{
+		"30/05/2020 10:00:00.000000 ORDER orderId: 1",
+		"01/06/2020 10:00:00.000000 ORDER orderId: 3",
+	})
+	mfs.SetFileData("execs.log", []string{
+		"31/05/2020 10:00:00.000000 EXEC orderId: 2",
+		"02/06/2020 10:00:00.000000 EXEC orderId: 4",
+	})
+	configFile := "merge_filterlogs.yaml"
+	mfs.SetFileData(configFile, strings.Split(`
+LineTimestamp:
+    StartPattern: '^'
+    PatternLength: 26
+    Layout: '02/01/2006 15:04:05.000000'
+Apps:
+    - AppName: Trades
+      LogLines:
+          - Tag: ORDER
+            Patterns: ['ORDER']
+            ExampleLine: '30/05/2020 10:00:00.000000 ORDER orderId: 1'
+            Elements:
+                OrderIdKey:
+                    StartPattern: 'orderId: '
+                    EndPattern: '$'
+          - Tag: EXEC
+            Patterns: ['EXEC']
+            ExampleLine: '31/05/2020 10:00:00.000000 EXEC orderId: 2'
+            Elements:
+                OrderIdKey:
+                    StartPattern: 'orderId: '
+                    EndPattern: '$'
+`, "\n"))
+
+	orderIds := []string{}
+	app := filterlogs.NewApp([]string{"orders.log", "execs.log"}, configFile, []string{}, false)
+	app.Run(func(config *filterlogs.ClientConfigType, filteredData map[string]*filterlogs.FilteredData) {
+		orderIds = append(orderIds, filteredData["OrderIdKey"].Text)
+	})
+	assert.Equal(t, []string{"1", "2", "3", "4"}, orderIds)
+}
+
+func Test_loglines_are_read_from_input_readers(t *testing.T) {
+	input := strings.NewReader("2020-06-02 14:33:56.531063 ORDER NEW price: 123.123, quantity: 1000, securityId: 999, side: BUY, bid: 124.0, ask: 125.0\n")
+
+	prices := []string{}
+	app := filterlogs.NewApp([]string{}, gConfigFile, gAnchorFiles, false)
+	app.AddInputReaders(input)
+	app.Run(func(config *filterlogs.ClientConfigType, filteredData map[string]*filterlogs.FilteredData) {
+		prices = append(prices, filteredData["PriceKey"].Text)
+	})
+	assert.Equal(t, []string{"123.123"}, prices)
+}
+
+func Test_elements_are_extracted_using_regex(t *testing.T) {
+	mfs := filesystem.GetFileSystem().(*filesystem.MockFileSystem)
+
+	mfs.SetFileData("regex.log", []string{
+		"2020-06-02 14:33:56.531063 ORDER NEW price: 123.123, quantity: 1000, securityId: 999, side: BUY, bid: 124.0, ask: 125.0",
+		"2020-06-02 14:33:57.000000 ORDER NEW price: 99, qty=25, securityId: 154, side: SELL",
+	})
+	configFile := "regex_filterlogs.yaml"
+	mfs.SetFileData(configFile, strings.Split(`
+Apps:
+    - AppName: Orders
+      LogLines:
+          - Tag: NEW
+            Patterns: ['ORDER NEW']
+            ExampleLine: '2020-06-02 14:33:56.531063 ORDER NEW price: 123.123, quantity: 1000, securityId: 999, side: BUY, bid: 124.0, ask: 125.0'
+            Regex: 'securityId: (?P<SecurityIdKey>\d+), side: (?P<SideKey>[A-Z]+)'
+            Elements:
+                PriceKey:
+                    ColumnName: price
+                    Regex: 'price: ([0-9.]+)'
+                QuantityKey:
+                    ColumnName: quantity
+                    Regex: '(?:quantity: |qty=)\d+'
+                SideKey:
+                    ColumnName: side
+`, "\n"))
+
+	config := filterlogs.NewConfig(configFile, []string{})
+	if !assert.NotNil(t, config, "config verification failed") {
+		return
+	}
+	header := []string{}
+	for _, metaInfo := range config.Apps[0].ClientConfig.MetaInfo {
+		header = append(header, metaInfo.ElementKey+":"+metaInfo.ColumnName)
+	}
+	assert.Equal(t, []string{"PriceKey:price", "QuantityKey:quantity", "SideKey:side", "SecurityIdKey:"}, header)
+
+	expectedFilteredData := []map[string]*filterlogs.FilteredData{
+		{
+			"PriceKey":      {Text: "123.123"},
+			"QuantityKey":   {Text: "quantity: 1000"},
+			"SecurityIdKey": {Text: "999"},
+			"SideKey":       {Text: "BUY"},
+		},
+		{
+			"PriceKey":      {Text: "99"},
+			"QuantityKey":   {Text: "qty=25"},
+			"SecurityIdKey": {Text: "154"},
+			"SideKey":       {Text: "SELL"},
+		},
+	}
+	filteredDataList := []map[string]*filterlogs.FilteredData{}
+	app := filterlogs.NewApp([]string{"regex.log"}, configFile, []string{}, false)
+	app.Run(func(config *filterlogs.ClientConfigType, filteredData map[string]*filterlogs.FilteredData) {
+		filteredDataList = append(filteredDataList, filteredData)
+	})
+	if diff := cmp.Diff(expectedFilteredData, filteredDataList); diff != "" {
+		t.Errorf("FilteredData not equal:\n%s", diff)
+	}
+}
+
+func Test_config_is_rejected_when_regex_does_not_match_ExampleLine(t *testing.T) {
+	mfs := filesystem.GetFileSystem().(*filesystem.MockFileSystem)
+
+	configFile := "bad_regex_filterlogs.yaml"
+	mfs.SetFileData(configFile, strings.Split(`
+Apps:
+    - AppName: Orders
+      LogLines:
+          - Tag: NEW
+            Patterns: ['ORDER NEW']
+            ExampleLine: '2020-06-02 14:33:56.531063 ORDER NEW price: 123.123'
+            Regex: 'quantity: (?P<QuantityKey>\d+)'
+`, "\n"))
+
+	captureStdout()
+	config := filterlogs.NewConfig(configFile, []string{})
+	output := getCapturedStdout()
+	assert.Nil(t, config)
+	assert.Contains(t, output, "Regex does not match the ExampleLine")
+}
+
+func runBlocksApp(t *testing.T, logLines []string, appConfig string) []map[string]string {
+	mfs := filesystem.GetFileSystem().(*filesystem.MockFileSystem)
+	mfs.SetFileData("blocks.log", logLines)
+	configFile := "blocks_filterlogs.yaml"
+	mfs.SetFileData(configFile, strings.Split(`
+Apps:
+    - AppName: Orders
+`+appConfig+`
+      LogLines:
+          - Tag: REQUEST
+            Patterns: ['REQUEST']
+            ExampleLine: 'REQUEST orderId: 1, price: 10'
+            Elements:
+                OrderIdKey: {StartPattern: 'orderId: ', EndPattern: ','}
+                PriceKey:   {StartPattern: 'price: ', EndPattern: '$'}
+          - Tag: ACK
+            Patterns: ['ACK']
+            ExampleLine: 'ACK orderId: 1, status: OK'
+            Elements:
+                OrderIdKey: {StartPattern: 'orderId: ', EndPattern: ','}
+                StatusKey:  {StartPattern: 'status: ', EndPattern: '$'}
+          - Tag: FILL
+            Patterns: ['FILL']
+            ExampleLine: 'FILL orderId: 1, qty: 5'
+            Elements:
+                OrderIdKey: {StartPattern: 'orderId: ', EndPattern: ','}
+                QtyKey:     {StartPattern: 'qty: ', EndPattern: '$', Type: int, OnTypeError: abort}
+`, "\n"))
+
+	records := []map[string]string{}
+	app := filterlogs.NewApp([]string{"blocks.log"}, configFile, []string{}, false)
+	app.Run(func(config *filterlogs.ClientConfigType, filteredData map[string]*filterlogs.FilteredData) {
+		record := map[string]string{"__tag__": config.Tag}
+		for eleKey, data := range filteredData {
+			record[eleKey] = data.Text
+		}
+		records = append(records, record)
+	})
+	return records
+}
+
+func Test_interleaved_blocks_are_assembled_using_BlockKey(t *testing.T) {
+	records := runBlocksApp(t, []string{
+		"REQUEST orderId: 1, price: 10",
+		"REQUEST orderId: 2, price: 20",
+		"ACK orderId: 2, status: OK",
+		"ACK orderId: 1, status: REJECTED",
+		"FILL orderId: 2, qty: 7",
+		"ACK orderId: 3, status: OK",
+		"FILL orderId: 1, qty: 5",
+		"REQUEST orderId: 4, price: 40",
+	}, `
+      StartBlockPattern: ['REQUEST']
+      EndBlockPattern: ['FILL']
+      BlockKey: OrderIdKey
+`)
+	expectedRecords := []map[string]string{
+		{"__tag__": "REQUEST", "OrderIdKey": "2", "PriceKey": "20", "StatusKey": "OK", "QtyKey": "7"},
+		{"__tag__": "REQUEST", "OrderIdKey": "1", "PriceKey": "10", "StatusKey": "REJECTED", "QtyKey": "5"},
+		// incomplete block is passed to the client at the end of input
+		{"__tag__": "REQUEST", "OrderIdKey": "4", "PriceKey": "40"},
+	}
+	assert.Equal(t, expectedRecords, records)
+}
+
+func Test_blocks_are_closed_by_BlockTimeout_and_nested_StartBlockPattern(t *testing.T) {
+	logLines := []string{
+		"REQUEST orderId: 1, price: 10",
+		"ACK orderId: 1, status: OK",
+		"REQUEST orderId: 1, price: 11",
+		"FILL orderId: 1, qty: 7",
+		"REQUEST orderId: 3, price: 30",
+		"ACK orderId: 3, status: OK",
+		"ACK orderId: 3, status: OK",
+		"FILL orderId: 3, qty: 9",
+	}
+
+	// first block of orderId 1 is closed by the nested REQUEST and block of orderId 3 is timed out before its FILL
+	records := runBlocksApp(t, logLines, `
+      StartBlockPattern: ['REQUEST']
+      EndBlockPattern: ['FILL']
+      BlockKey: OrderIdKey
+      BlockTimeout: 2
+`)
+	expectedRecords := []map[string]string{
+		{"__tag__": "REQUEST", "OrderIdKey": "1", "PriceKey": "10", "StatusKey": "OK"},
+		{"__tag__": "REQUEST", "OrderIdKey": "1", "PriceKey": "11", "QtyKey": "7"},
+		{"__tag__": "REQUEST", "OrderIdKey": "3", "PriceKey": "30", "StatusKey": "OK"},
+	}
+	assert.Equal(t, expectedRecords, records)
+
+	records = runBlocksApp(t, logLines, `
+      StartBlockPattern: ['REQUEST']
+      EndBlockPattern: ['FILL']
+      BlockKey: OrderIdKey
+      BlockTimeout: 2
+      DropIncompleteBlocks: true
+`)
+	expectedRecords = []map[string]string{
+		{"__tag__": "REQUEST", "OrderIdKey": "1", "PriceKey": "11", "QtyKey": "7"},
+	}
+	assert.Equal(t, expectedRecords, records)
+
+	// nested REQUEST is treated as a normal line of the open block
+	records = runBlocksApp(t, logLines[:4], `
+      StartBlockPattern: ['REQUEST']
+      EndBlockPattern: ['FILL']
+      BlockKey: OrderIdKey
+      NestedBlocks: ignore
+`)
+	expectedRecords = []map[string]string{
+		{"__tag__": "REQUEST", "OrderIdKey": "1", "PriceKey": "11", "StatusKey": "OK", "QtyKey": "7"},
+	}
+	assert.Equal(t, expectedRecords, records)
+}
+
+func Test_BlockKey_is_extracted_from_the_lines_of_the_block_patterns(t *testing.T) {
+	records := runBlocksApp(t, []string{
+		"BEGIN orderId: 1, session: A",
+		"BEGIN orderId: 2, session: A",
+		"REQUEST orderId: 2, price: 20",
+		"REQUEST orderId: 1, price: 10",
+		"END orderId: 2, session: A",
+		"ACK orderId: 1, status: OK",
+		"END orderId: 1, session: A",
+	}, `
+      StartBlockPattern: ['BEGIN']
+      EndBlockPattern: ['END']
+      BlockKey: OrderIdKey
+`)
+	expectedRecords := []map[string]string{
+		{"__tag__": "REQUEST", "OrderIdKey": "2", "PriceKey": "20"},
+		{"__tag__": "REQUEST", "OrderIdKey": "1", "PriceKey": "10", "StatusKey": "OK"},
+	}
+	assert.Equal(t, expectedRecords, records)
+}
+
+func Test_blocks_delimited_only_by_StartBlockPattern(t *testing.T) {
+	records := runBlocksApp(t, []string{
+		"ACK orderId: 0, status: OK",
+		"REQUEST orderId: 1, price: 10",
+		"FILL orderId: 1, qty: 5",
+		"REQUEST orderId: 2, price: 20",
+	}, `
+      StartBlockPattern: ['REQUEST']
+`)
+	expectedRecords := []map[string]string{
+		{"__tag__": "REQUEST", "OrderIdKey": "1", "PriceKey": "10", "QtyKey": "5"},
+		{"__tag__": "REQUEST", "OrderIdKey": "2", "PriceKey": "20"},
+	}
+	assert.Equal(t, expectedRecords, records)
+}
+
+func Test_open_blocks_are_dropped_after_aborting(t *testing.T) {
+	captureStdout()
+	records := runBlocksApp(t, []string{
+		"REQUEST orderId: 1, price: 10",
+		"REQUEST orderId: 2, price: 20",
+		"FILL orderId: 1, qty: 5x",
+		"FILL orderId: 2, qty: 7",
+	}, `
+      StartBlockPattern: ['REQUEST']
+      EndBlockPattern: ['FILL']
+      BlockKey: OrderIdKey
+`)
+	assert.Contains(t, getCapturedStdout(), "ERROR, aborting")
+	assert.Empty(t, records)
+}
+
+func Test_After_and_Occurrence_pick_repeated_patterns(t *testing.T) {
+	mfs := filesystem.GetFileSystem().(*filesystem.MockFileSystem)
+	mfs.SetFileData("quotes.log", []string{"QUOTE bid: 1, ask: 2, venue: X, bid: 3, ask: 4, venue: Y, bid: 5, ask: 6"})
+	configFile := "after_filterlogs.yaml"
+	mfs.SetFileData(configFile, strings.Split(`
+Apps:
+    - AppName: Quotes
+      LogLines:
+          - Tag: QUOTE
+            Patterns: ['QUOTE']
+            ExampleLine: 'QUOTE bid: 1, ask: 2, venue: X, bid: 3, ask: 4, venue: Y, bid: 5, ask: 6'
+            Elements:
+                FirstBidKey:  {StartPattern: 'bid: ', EndPattern: ','}
+                SecondBidKey: {StartPattern: 'bid: ', EndPattern: ',', Occurrence: 2}
+                VenueBidKey:  {StartPattern: 'bid: ', EndPattern: ',', After: 'venue: '}
+                ThirdAskKey:  {Regex: 'ask: (\d+)', After: 'venue: ', Occurrence: 2}
+`, "\n"))
+
+	config := filterlogs.NewConfig(configFile, []string{})
+	if !assert.NotNil(t, config, "config verification failed") {
+		return
+	}
+	assert.Contains(t, config.Apps[0].LogLines[0].Elements["VenueBidKey"].Formatted(), "'venue: '")
+
+	expectedFilteredData := map[string]*filterlogs.FilteredData{
+		"FirstBidKey":  {Text: "1"},
+		"SecondBidKey": {Text: "3"},
+		"VenueBidKey":  {Text: "3"},
+		"ThirdAskKey":  {Text: "6"},
+	}
+	callbackCalled := false
+	app := filterlogs.NewApp([]string{"quotes.log"}, configFile, []string{}, false)
+	app.Run(func(config *filterlogs.ClientConfigType, filteredData map[string]*filterlogs.FilteredData) {
+		if diff := cmp.Diff(expectedFilteredData, filteredData); diff != "" {
+			t.Errorf("FilteredData map not equal:\n%s", diff)
+		}
+		callbackCalled = true
+	})
+	assert.True(t, callbackCalled, "Assigned callback is not called. Please check the config.")
+}
+
+func Test_config_is_rejected_when_Occurrence_is_not_found_in_ExampleLine(t *testing.T) {
+	mfs := filesystem.GetFileSystem().(*filesystem.MockFileSystem)
+	configFile := "bad_after_filterlogs.yaml"
+	mfs.SetFileData(configFile, strings.Split(`
+Apps:
+    - AppName: Quotes
+      LogLines:
+          - Tag: QUOTE
+            Patterns: ['QUOTE']
+            ExampleLine: 'QUOTE bid: 1, ask: 2, venue: X, bid: 3, ask: 4'
+            Elements:
+                ThirdBidKey: {StartPattern: 'bid: ', EndPattern: ',', Occurrence: 3}
+`, "\n"))
+
+	captureStdout()
+	config := filterlogs.NewConfig(configFile, []string{})
+	output := getCapturedStdout()
+	assert.Nil(t, config)
+	assert.Contains(t, output, "Element not found in ExampleLine after applying After and Occurrence")
+}
+
+func runTypedApp(t *testing.T, logLines []string, priceElement string) ([]map[string]*filterlogs.FilteredData, *filterlogs.App) {
+	mfs := filesystem.GetFileSystem().(*filesystem.MockFileSystem)
+	mfs.SetFileData("typed.log", logLines)
+	configFile := "typed_filterlogs.yaml"
+	mfs.SetFileData(configFile, strings.Split(`
+Apps:
+    - AppName: Orders
+      LogLines:
+          - Tag: NEW
+            Patterns: ['ORDER NEW']
+            ExampleLine: '2020-06-02 14:33:56.531063 ORDER NEW price: 123.125, quantity: 1000, latency: 1.5ms, urgent: true'
+            Elements:
+                TimeStampKey: {StartPattern: '^', PatternLength: 26, Type: timestamp, Layout: '2006-01-02 15:04:05.000000'}
+                PriceKey:     `+priceElement+`
+                QuantityKey:  {StartPattern: 'quantity: ', EndPattern: ',', Type: int}
+                LatencyKey:   {StartPattern: 'latency: ', EndPattern: ',', Type: duration}
+                UrgentKey:    {StartPattern: 'urgent: ', EndPattern: '$', Type: bool}
+`, "\n"))
+
+	filteredDataList := []map[string]*filterlogs.FilteredData{}
+	app := filterlogs.NewApp([]string{"typed.log"}, configFile, []string{}, false)
+	app.Run(func(config *filterlogs.ClientConfigType, filteredData map[string]*filterlogs.FilteredData) {
+		filteredDataList = append(filteredDataList, filteredData)
+	})
+	return filteredDataList, app
+}
+
+func Test_typed_values_are_parsed_and_added_to_MetaInfo(t *testing.T) {
+	logLines := []string{"2020-06-02 14:33:56.531063 ORDER NEW price: 123.125, quantity: 1000, latency: 1.5ms, urgent: true"}
+	filteredDataList, _ := runTypedApp(t, logLines, "{StartPattern: 'price: ', EndPattern: ',', Type: float}")
+	if !assert.Len(t, filteredDataList, 1) {
+		return
+	}
+	filteredData := filteredDataList[0]
+	assert.Equal(t, "123.125", filteredData["PriceKey"].Text)
+	assert.Equal(t, 123.125, filteredData["PriceKey"].Value)
+	assert.Equal(t, int64(1000), filteredData["QuantityKey"].Value)
+	assert.Equal(t, 1500*time.Microsecond, filteredData["LatencyKey"].Value)
+	assert.Equal(t, true, filteredData["UrgentKey"].Value)
+	assert.Equal(t, time.Date(2020, 6, 2, 14, 33, 56, 531063000, time.UTC), filteredData["TimeStampKey"].Value)
+
+	config := filterlogs.NewConfig("typed_filterlogs.yaml", []string{})
+	if !assert.NotNil(t, config, "config verification failed") {
+		return
+	}
+	types := map[string]string{}
+	for _, metaInfo := range config.Apps[0].ClientConfig.MetaInfo {
+		types[metaInfo.ElementKey] = metaInfo.Type
+	}
+	assert.Equal(t, map[string]string{
+		"TimeStampKey": filterlogs.TypeTimestamp,
+		"PriceKey":     filterlogs.TypeFloat,
+		"QuantityKey":  filterlogs.TypeInt,
+		"LatencyKey":   filterlogs.TypeDuration,
+		"UrgentKey":    filterlogs.TypeBool,
+	}, types)
+}
+
+func Test_OnTypeError_policies(t *testing.T) {
+	logLines := []string{
+		"2020-06-02 14:33:56.531063 ORDER NEW price: 12x.1, quantity: 1000, latency: 1.5ms, urgent: true",
+		"2020-06-02 14:33:57.000000 ORDER NEW price: 99.5, quantity: 25, latency: 2s, urgent: false",
+	}
+
+	filteredDataList, _ := runTypedApp(t, logLines, "{StartPattern: 'price: ', EndPattern: ',', Type: decimal}")
+	if assert.Len(t, filteredDataList, 2) {
+		assert.Equal(t, "12x.1", filteredDataList[0]["PriceKey"].Text)
+		assert.Nil(t, filteredDataList[0]["PriceKey"].Value)
+		assert.Equal(t, "199/2", filteredDataList[1]["PriceKey"].Value.(*big.Rat).String())
+	}
+
+	filteredDataList, _ = runTypedApp(t, logLines, "{StartPattern: 'price: ', EndPattern: ',', Type: decimal, OnTypeError: N/F}")
+	if assert.Len(t, filteredDataList, 2) {
+		assert.Equal(t, "N/F", filteredDataList[0]["PriceKey"].Text)
+		assert.Nil(t, filteredDataList[0]["PriceKey"].Value)
+	}
+
+	filteredDataList, _ = runTypedApp(t, logLines, "{StartPattern: 'price: ', EndPattern: ',', Type: decimal, OnTypeError: drop}")
+	if assert.Len(t, filteredDataList, 1) {
+		assert.Equal(t, "99.5", filteredDataList[0]["PriceKey"].Text)
+	}
+
+	captureStdout()
+	filteredDataList, app := runTypedApp(t, logLines, "{StartPattern: 'price: ', EndPattern: ',', Type: decimal, OnTypeError: abort}")
+	output := getCapturedStdout()
+	assert.Len(t, filteredDataList, 0)
+	assert.Error(t, app.Err())
+	assert.Contains(t, output, "ERROR, aborting")
+}
+
+func Test_config_is_rejected_when_typed_value_in_ExampleLine_cannot_be_parsed(t *testing.T) {
+	mfs := filesystem.GetFileSystem().(*filesystem.MockFileSystem)
+	configFile := "bad_typed_filterlogs.yaml"
+	mfs.SetFileData(configFile, strings.Split(`
+Apps:
+    - AppName: Orders
+      LogLines:
+          - Tag: NEW
+            Patterns: ['ORDER NEW']
+            ExampleLine: '2020-06-02 14:33:56.531063 ORDER NEW price: 123.123, quantity: many'
+            Elements:
+                QuantityKey: {StartPattern: 'quantity: ', EndPattern: '$', Type: int}
+`, "\n"))
+
+	captureStdout()
+	config := filterlogs.NewConfig(configFile, []string{})
+	output := getCapturedStdout()
+	assert.Nil(t, config)
+	assert.Contains(t, output, "Value in ExampleLine cannot be parsed into its Type")
+}
+
+func Test_ComputedColumns_are_evaluated_for_each_record(t *testing.T) {
+	mfs := filesystem.GetFileSystem().(*filesystem.MockFileSystem)
+	mfs.SetFileData("computed.log", []string{
+		"ORDER NEW price: 10.5, quantity: 4, side: buy, bid: 10.25, ask: 10.75",
+		"ORDER NEW price: 12, quantity: 2, side: sell, venue: X",
+	})
+	configFile := "computed_filterlogs.yaml"
+	mfs.SetFileData(configFile, strings.Split(`
+Apps:
+    - AppName: Orders
+      LogLines:
+          - Tag: NEW
+            Patterns: ['ORDER NEW']
+            ExampleLine: 'ORDER NEW price: 10.5, quantity: 4, side: buy, bid: 10.25, ask: 10.75'
+            Elements:
+                PriceKey:    {ColumnName: price, StartPattern: 'price: ', EndPattern: ','}
+                QuantityKey: {ColumnName: quantity, StartPattern: 'quantity: ', EndPattern: ',', Type: int}
+                SideKey:     {ColumnName: side, StartPattern: 'side: ', EndPattern: ','}
+                BidKey:      {StartPattern: 'bid: ', EndPattern: ','}
+                AskKey:      {StartPattern: 'ask: ', EndPattern: '$'}
+      ComputedColumns:
+          - {ElementKey: NotionalKey, ColumnName: notional, Expression: 'price * quantity'}
+          - {ElementKey: SpreadKey, ColumnName: spread, Expression: 'AskKey - BidKey'}
+          - {ElementKey: LabelKey, Expression: "concat(upper(side), '-', if(notional > 30, 'large', 'small'))"}
+`, "\n"))
+
+	config := filterlogs.NewConfig(configFile, []string{})
+	if !assert.NotNil(t, config, "config verification failed") {
+		return
+	}
+	header := []string{}
+	for _, metaInfo := range config.Apps[0].ClientConfig.MetaInfo {
+		header = append(header, metaInfo.ElementKey)
+	}
+	assert.Equal(t, []string{"PriceKey", "QuantityKey", "SideKey", "BidKey", "AskKey", "NotionalKey", "SpreadKey", "LabelKey"}, header)
+
+	records := []map[string]string{}
+	app := filterlogs.NewApp([]string{"computed.log"}, configFile, []string{}, false)
+	app.Run(func(config *filterlogs.ClientConfigType, filteredData map[string]*filterlogs.FilteredData) {
+		record := map[string]string{}
+		for _, eleKey := range []string{"NotionalKey", "SpreadKey", "LabelKey"} {
+			record[eleKey] = filteredData[eleKey].Text
+		}
+		records = append(records, record)
+	})
+	assert.Equal(t, []map[string]string{
+		{"NotionalKey": "42", "SpreadKey": "0.5", "LabelKey": "BUY-large"},
+		{"NotionalKey": "24", "SpreadKey": "N/F", "LabelKey": "SELL-small"},
+	}, records)
+}
+
+func Test_config_is_rejected_when_ComputedColumns_reference_unknown_elements(t *testing.T) {
+	mfs := filesystem.GetFileSystem().(*filesystem.MockFileSystem)
+	configFile := "bad_computed_filterlogs.yaml"
+	mfs.SetFileData(configFile, strings.Split(`
+Apps:
+    - AppName: Orders
+      LogLines:
+          - Tag: NEW
+            Patterns: ['ORDER NEW']
+            ExampleLine: 'ORDER NEW price: 10.5, quantity: 4'
+            Elements:
+                PriceKey: {StartPattern: 'price: ', EndPattern: ','}
+      ComputedColumns:
+          - {ElementKey: NotionalKey, Expression: 'PriceKey * QuantityKey'}
+`, "\n"))
+
+	captureStdout()
+	config := filterlogs.NewConfig(configFile, []string{})
+	output := getCapturedStdout()
+	assert.Nil(t, config)
+	assert.Contains(t, output, `unknown element "QuantityKey"`)
+}
+
+func outputElementsConfig(outputElements string) *filterlogs.Config {
+	mfs := filesystem.GetFileSystem().(*filesystem.MockFileSystem)
+	configFile := "output_elements_filterlogs.yaml"
+	mfs.SetFileData(configFile, strings.Split(`
+Apps:
+    - AppName: Orders
+      OutputElements: `+outputElements+`
+      LogLines:
+          - Tag: NEW
+            Patterns: ['ORDER NEW']
+            ExampleLine: 'ORDER NEW price: 10.5, quantity: 4, bid: 10.25, ask: 10.75'
+            Elements:
+                PriceKey:    {ColumnName: price, StartPattern: 'price: ', EndPattern: ','}
+                QuantityKey: {ColumnName: quantity, StartPattern: 'quantity: ', EndPattern: ','}
+                BidKey:      {StartPattern: 'bid: ', EndPattern: ','}
+                AskKey:      {StartPattern: 'ask: ', EndPattern: '$'}
+      ComputedColumns:
+          - {ElementKey: MidKey, Expression: '(BidKey + AskKey) / 2'}
+`, "\n"))
+	return filterlogs.NewConfig(configFile, []string{})
+}
+
+func Test_OutputElements_select_and_order_the_output_columns(t *testing.T) {
+	header := func(config *filterlogs.Config) []string {
+		elementKeys := []string{}
+		for _, metaInfo := range config.Apps[0].ClientConfig.MetaInfo {
+			elementKeys = append(elementKeys, metaInfo.ElementKey)
+		}
+		return elementKeys
+	}
+
+	config := outputElementsConfig("[]")
+	if assert.NotNil(t, config, "config verification failed") {
+		assert.Equal(t, []string{"PriceKey", "QuantityKey", "BidKey", "AskKey", "MidKey"}, header(config))
+	}
+
+	config = outputElementsConfig("[MidKey, QuantityKey, PriceKey]")
+	if assert.NotNil(t, config, "config verification failed") {
+		assert.Equal(t, []string{"MidKey", "QuantityKey", "PriceKey"}, header(config))
+	}
+
+	// excluded elements are still available to the computed columns
+	config = outputElementsConfig("['-BidKey', '-AskKey']")
+	if assert.NotNil(t, config, "config verification failed") {
+		assert.Equal(t, []string{"PriceKey", "QuantityKey", "MidKey"}, header(config))
+	}
+
+	captureStdout()
+	config = outputElementsConfig("[PriceKey, SideKey]")
+	output := getCapturedStdout()
+	assert.Nil(t, config)
+	assert.Contains(t, output, "OutputElements contains an ElementKey which is not present in any LogLine or ComputedColumns")
+}
+
+func runTimeRangeApp(t *testing.T, timeRangeConfig, since, until string) []string {
+	mfs := filesystem.GetFileSystem().(*filesystem.MockFileSystem)
+	mfs.SetFileData("timerange.log", []string{
+		"2020-06-01 09:00:00.000000 ORDER orderId: 1, sent: 20200601-08:59:59",
+		"2020-06-01 15:00:00.000000 ORDER orderId: 2, sent: 20200601-14:59:59",
+		"2020-06-02 09:30:00.000000 ORDER orderId: 3, sent: 20200602-09:29:59",
+		"2020-06-02 16:00:00.000000 ORDER orderId: 4, sent: 20200602-15:59:59",
+		"2020-06-03 10:00:00.000000 ORDER orderId: 5, sent: 20200603-09:59:59",
+	})
+	configFile := "timerange_filterlogs.yaml"
+	mfs.SetFileData(configFile, strings.Split(timeRangeConfig+`
+Apps:
+    - AppName: Orders
+      TimestampElement: SentKey
+      LogLines:
+          - Tag: ORDER
+            Patterns: ['ORDER']
+            ExampleLine: '2020-06-01 09:00:00.000000 ORDER orderId: 1, sent: 20200601-08:59:59'
+            Elements:
+                OrderIdKey:
+                    StartPattern: 'orderId: '
+                    EndPattern: ','
+                SentKey:
+                    StartPattern: 'sent: '
+                    EndPattern: '$'
+                    Type: timestamp
+                    Layout: '20060102-15:04:05'
+`, "\n"))
+
+	orderIds := []string{}
+	app := filterlogs.NewApp([]string{"timerange.log"}, configFile, []string{}, false)
+	app.SetTimeRange(since, until)
+	app.Run(func(config *filterlogs.ClientConfigType, filteredData map[string]*filterlogs.FilteredData) {
+		orderIds = append(orderIds, filteredData["OrderIdKey"].Text)
+	})
+	return orderIds
+}
+
+func Test_records_are_filtered_by_Since_and_Until(t *testing.T) {
+	// Since is inclusive and Until is exclusive, TimestampElement is compared instead of the time of the logline
+	assert.Equal(t, []string{"2", "3"}, runTimeRangeApp(t, "", "2020-06-01 14:59:59", "2020-06-02 15:59:59"))
+	assert.Equal(t, []string{"4", "5"}, runTimeRangeApp(t, "Since: '2020-06-02T10:00:00Z'", "", ""))
+	assert.Equal(t, []string{"1", "2", "3"}, runTimeRangeApp(t, "Until: '2020-06-02T12:00:00Z'", "", ""))
+	// flags override the config
+	assert.Equal(t, []string{"5"}, runTimeRangeApp(t, "Since: '2020-06-01'", "2020-06-03", ""))
+	// only the time of the day is compared if the date is not given
+	assert.Equal(t, []string{"2", "3", "5"}, runTimeRangeApp(t, "", "09:15", "15:00"))
+	assert.Equal(t, []string{"1", "4"}, runTimeRangeApp(t, "", "15:30", "09:15"))
+	assert.Equal(t, []string{"1", "2", "3", "4", "5"}, runTimeRangeApp(t, "", "", ""))
+}
+
+func Test_records_are_filtered_by_Since_and_Until_using_LineTimestamp(t *testing.T) {
+	mfs := filesystem.GetFileSystem().(*filesystem.MockFileSystem)
+	logLines := []string{}
+	for i := 0; i < 5000; i++ {
+		ts := time.Date(2020, 6, 2, 9, 0, 0, 0, time.UTC).Add(time.Duration(i) * time.Second)
+		logLines = append(logLines, ts.Format("2006-01-02 15:04:05.000000")+" ORDER NEW price: "+strconv.Itoa(i)+
+			", quantity: 1000, securityId: 999, side: BUY, bid: 124.0, ask: 125.0")
+	}
+	mfs.SetFileData("timerange_lines.log", logLines)
+	configFile := "timerange_lines_filterlogs.yaml"
+	mfs.SetFileData(configFile, strings.Split(`
+LineTimestamp:
+    StartPattern: '^'
+    PatternLength: 26
+    Layout: '2006-01-02 15:04:05.000000'
+Since: '2020-06-02 10:00:00'
+Until: '2020-06-02 10:00:03'
+Apps:
+    - AppName: Orders
+      LogLines:
+          - Tag: NEW
+            Patterns: ['ORDER NEW']
+            ExampleLine: '2020-06-02 09:00:00.000000 ORDER NEW price: 0, quantity: 1000'
+            Elements:
+                PriceKey:
+                    StartPattern: 'price: '
+                    EndPattern: ','
+`, "\n"))
+
+	prices := []string{}
+	lineNumbers := []int{}
+	app := filterlogs.NewApp([]string{"timerange_lines.log"}, configFile, []string{}, false)
+	app.Run(func(config *filterlogs.ClientConfigType, filteredData map[string]*filterlogs.FilteredData) {
+		prices = append(prices, filteredData["PriceKey"].Text)
+		lineNumbers = append(lineNumbers, config.LineNo)
+	})
+	assert.Equal(t, []string{"3600", "3601", "3602"}, prices)
+	assert.Equal(t, []int{3601, 3602, 3603}, lineNumbers)
+}
+
+func Test_config_is_rejected_when_time_range_cannot_be_compared(t *testing.T) {
+	captureStdout()
+	assert.Empty(t, runTimeRangeApp(t, "", "yesterday", ""))
+	assert.Empty(t, runTimeRangeApp(t, "", "2020-06-02", "2020-06-01"))
+	assert.Empty(t, runTimeRangeApp(t, "", "2020-06-02", "15:00"))
+	output := getCapturedStdout()
+	assert.Contains(t, output, `invalid Since, cannot parse "yesterday"`)
+	assert.Contains(t, output, `Since "2020-06-02" must be before Until "2020-06-01"`)
+	assert.Contains(t, output, "must both be a time of the day or both be a date")
+}
+
+func runWhereApp(t *testing.T, where, loglineWhere, whereFlag string) []string {
+	mfs := filesystem.GetFileSystem().(*filesystem.MockFileSystem)
+	mfs.SetFileData("where.log", []string{
+		"ORDER NEW orderId: 1, side: BUY, quantity: 100, securityId: 999, text: in [1]",
+		"ORDER NEW orderId: 2, side: SELL, quantity: 600, securityId: 999, text: in [2]",
+		"ORDER NEW orderId: 3, side: BUY, quantity: 700, securityId: 154, text: abc",
+		"ORDER NEW orderId: 4, side: BUY, quantity: 800, securityId: 155, text: in [4]",
+		"ORDER CANCEL orderId: 5, securityId: 999",
+	})
+	configFile := "where_filterlogs.yaml"
+	mfs.SetFileData(configFile, strings.Split(`
+Apps:
+    - AppName: Orders
+      Where: "`+where+`"
+      ComputedColumns:
+          - ElementKey: NotionalKey
+            ColumnName: notional
+            Expression: 'quantity * 10'
+      LogLines:
+          - Tag: NEW
+            Patterns: ['ORDER NEW']
+            ExampleLine: 'ORDER NEW orderId: 1, side: BUY, quantity: 100, securityId: 999, text: in [1]'
+            Where: "`+loglineWhere+`"
+            Elements:
+                OrderIdKey:
+                    ColumnName: orderId
+                    StartPattern: 'orderId: '
+                    EndPattern: ','
+                SideKey:
+                    ColumnName: side
+                    StartPattern: 'side: '
+                    EndPattern: ','
+                QuantityKey:
+                    ColumnName: quantity
+                    StartPattern: 'quantity: '
+                    EndPattern: ','
+                SecurityIdKey:
+                    ColumnName: securityId
+                    StartPattern: 'securityId: '
+                    EndPattern: ','
+                TextKey:
+                    ColumnName: text
+                    StartPattern: 'text: '
+                    EndPattern: '$'
+          - Tag: CANCEL
+            Patterns: ['ORDER CANCEL']
+            ExampleLine: 'ORDER CANCEL orderId: 5, securityId: 999'
+            Elements:
+                OrderIdKey:
+                    ColumnName: orderId
+                    StartPattern: 'orderId: '
+                    EndPattern: ','
+                SecurityIdKey:
+                    ColumnName: securityId
+                    StartPattern: 'securityId: '
+                    EndPattern: '$'
+`, "\n"))
+
+	orderIds := []string{}
+	app := filterlogs.NewApp([]string{"where.log"}, configFile, []string{}, false)
+	app.SetWhere(whereFlag)
+	app.Run(func(config *filterlogs.ClientConfigType, filteredData map[string]*filterlogs.FilteredData) {
+		orderIds = append(orderIds, filteredData["OrderIdKey"].Text)
+	})
+	return orderIds
+}
+
+func Test_records_are_filtered_by_Where(t *testing.T) {
+	assert.Equal(t, []string{"1", "2", "3", "4", "5"}, runWhereApp(t, "", "", ""))
+	assert.Equal(t, []string{"3", "4"}, runWhereApp(t, "side == 'BUY' && quantity > 500", "", ""))
+	assert.Equal(t, []string{"3", "4"}, runWhereApp(t, `side == \"BUY\" && QuantityKey > 500`, "", ""))
+	assert.Equal(t, []string{"1", "2", "3", "5"}, runWhereApp(t, "securityId in [999, 154]", "", ""))
+	// quoted lists are not the in operator
+	assert.Equal(t, []string{"1", "4"}, runWhereApp(t, "text in ['in [1]', 'in [4]']", "", ""))
+	// computed columns can be used in Where
+	assert.Equal(t, []string{"4"}, runWhereApp(t, "notional >= 8000", "", ""))
+	// Where of a logline only filters its own loglines
+	assert.Equal(t, []string{"2", "5"}, runWhereApp(t, "", "side != 'BUY'", ""))
+	// Where given by the flag is applied along with the config
+	assert.Equal(t, []string{"3"}, runWhereApp(t, "side == 'BUY' && quantity > 500", "", "securityId in [154]"))
+}
+
+func runWhereFlagApp(t *testing.T, keepOtherApps bool) []string {
+	mfs := filesystem.GetFileSystem().(*filesystem.MockFileSystem)
+	mfs.SetFileData("whereflag.log", []string{
+		"ORDER NEW orderId: 1, quantity: 100, securityId: 999",
+		"POSITION securityId: 999, netPosition: 100",
+		"ORDER NEW orderId: 2, quantity: 600, securityId: 154",
+	})
+	configFile := "whereflag_filterlogs.yaml"
+	mfs.SetFileData(configFile, strings.Split(`
+Apps:
+    - AppName: Orders
+      LogLines:
+          - Tag: NEW
+            Patterns: ['ORDER NEW']
+            ExampleLine: 'ORDER NEW orderId: 1, quantity: 100, securityId: 999'
+            Elements:
+                OrderIdKey: {ColumnName: orderId, StartPattern: 'orderId: ', EndPattern: ','}
+                QuantityKey: {ColumnName: quantity, StartPattern: 'quantity: ', EndPattern: ','}
+                SecurityIdKey: {ColumnName: securityId, StartPattern: 'securityId: ', EndPattern: '$'}
+    - AppName: Positions
+      LogLines:
+          - Tag: POSITION
+            Patterns: ['POSITION']
+            ExampleLine: 'POSITION securityId: 999, netPosition: 100'
+            Elements:
+                SecurityIdKey: {ColumnName: securityId, StartPattern: 'securityId: ', EndPattern: ','}
+                NetPositionKey: {ColumnName: netPosition, StartPattern: 'netPosition: ', EndPattern: '$'}
+`, "\n"))
+
+	records := []string{}
+	app := filterlogs.NewApp([]string{"whereflag.log"}, configFile, []string{}, false)
+	app.SetWhere("quantity > 500")
+	app.SetWhereKeepOtherApps(keepOtherApps)
+	app.Run(func(config *filterlogs.ClientConfigType, filteredData map[string]*filterlogs.FilteredData) {
+		records = append(records, config.AppName+" "+filteredData["SecurityIdKey"].Text)
+	})
+	return records
+}
+
+func Test_Where_flag_drops_the_records_of_apps_without_its_elements(t *testing.T) {
+	captureStdout()
+	assert.Equal(t, []string{"Orders 154"}, runWhereFlagApp(t, false))
+	assert.Equal(t, []string{"Positions 999", "Orders 154"}, runWhereFlagApp(t, true))
+	output := getCapturedStdout()
+	assert.Contains(t, output, "WARN, records of app Positions are dropped as it does not have all the elements used in Where quantity > 500")
+	assert.Contains(t, output, "WARN, Where is not applied to app Positions as it does not have all the elements used in quantity > 500")
+}
+
+func Test_config_is_rejected_when_Where_uses_unknown_elements(t *testing.T) {
+	captureStdout()
+	assert.Empty(t, runWhereApp(t, "price > 100", "", ""))
+	assert.Empty(t, runWhereApp(t, "", "notional > 100", ""))
+	assert.Empty(t, runWhereApp(t, "", "", "price > 100"))
+	output := getCapturedStdout()
+	assert.Contains(t, output, `Invalid Where config, unknown element "price" in Where "price > 100" Orders`)
+	assert.Contains(t, output, `Invalid Where config, unknown element "notional" in Where "notional > 100" Orders NEW`)
+	assert.Contains(t, output, `ERROR, Where cannot be applied to any app, unknown element "price" in Where "price > 100"`)
+}
+
+func runFillForwardApp(t *testing.T, strategyConfig string) []string {
+	mfs := filesystem.GetFileSystem().(*filesystem.MockFileSystem)
+	mfs.SetFileData("fillforward.log", []string{
+		"ORDER NEW orderId: 1, securityId: 999",
+		"SESSION sessionId: A1",
+		"STRATEGY securityId: 999, strategy: momentum",
+		"ORDER NEW orderId: 2, securityId: 999",
+		"ORDER NEW orderId: 3, securityId: 154",
+		"STRATEGY securityId: 154, strategy: meanrev",
+		"SESSION sessionId: B2",
+		"ORDER NEW orderId: 4, securityId: 154",
+		"ORDER NEW orderId: 5, securityId: 999",
+	})
+	configFile := "fillforward_filterlogs.yaml"
+	mfs.SetFileData(configFile, strings.Split(`
+Apps:
+    - AppName: Orders
+      LogLines:
+          - Tag: SESSION
+            Patterns: ['SESSION']
+            ExampleLine: 'SESSION sessionId: A1'
+            Elements:
+                SessionIdKey:
+                    StartPattern: 'sessionId: '
+                    EndPattern: '$'
+                    FillForward: true
+          - Tag: STRATEGY
+            Patterns: ['STRATEGY']
+            ExampleLine: 'STRATEGY securityId: 999, strategy: momentum'
+            Elements:
+                SecurityIdKey:
+                    StartPattern: 'securityId: '
+                    EndPattern: ','
+                StrategyKey:
+                    StartPattern: 'strategy: '
+                    EndPattern: '$'
+`+strategyConfig+`
+          - Tag: NEW
+            Patterns: ['ORDER NEW']
+            ExampleLine: 'ORDER NEW orderId: 1, securityId: 999'
+            Elements:
+                OrderIdKey:
+                    StartPattern: 'orderId: '
+                    EndPattern: ','
+                SecurityIdKey:
+                    StartPattern: 'securityId: '
+                    EndPattern: '$'
+`, "\n"))
+
+	records := []string{}
+	app := filterlogs.NewApp([]string{"fillforward.log"}, configFile, []string{}, false)
+	app.Run(func(config *filterlogs.ClientConfigType, filteredData map[string]*filterlogs.FilteredData) {
+		if config.Tag != "NEW" {
+			return
+		}
+		record := filteredData["OrderIdKey"].Text
+		for _, eleKey := range []string{"SessionIdKey", "StrategyKey"} {
+			if filteredData[eleKey] == nil {
+				record += ",N/A"
+			} else {
+				record += "," + filteredData[eleKey].Text
+			}
+		}
+		records = append(records, record)
+	})
+	return records
+}
+
+func Test_FillForward_elements_keep_their_last_seen_value(t *testing.T) {
+	assert.Equal(t, []string{"1,N/A,N/A", "2,A1,N/A", "3,A1,N/A", "4,B2,N/A", "5,B2,N/A"}, runFillForwardApp(t, ""))
+	assert.Equal(t, []string{"1,N/A,N/A", "2,A1,momentum", "3,A1,momentum", "4,B2,meanrev", "5,B2,meanrev"},
+		runFillForwardApp(t, "                    FillForward: true"))
+	// last value of each securityId
+	assert.Equal(t, []string{"1,N/A,N/A", "2,A1,momentum", "3,A1,N/A", "4,B2,meanrev", "5,B2,momentum"},
+		runFillForwardApp(t, "                    FillForward: true\n                    FillForwardBy: SecurityIdKey"))
+
+	captureStdout()
+	assert.Empty(t, runFillForwardApp(t, "                    FillForward: true\n                    FillForwardBy: SideKey"))
+	assert.Contains(t, getCapturedStdout(), "FillForwardBy is not an ElementKey of the app Orders StrategyKey SideKey")
+}
+
+func runDeltaApp(t *testing.T, deltaColumns string) []string {
+	mfs := filesystem.GetFileSystem().(*filesystem.MockFileSystem)
+	mfs.SetFileData("delta.log", []string{
+		"ORDER NEW time: 20200601-09:00:00, securityId: 999, netPosition: 100, latency: 2500000h0m0.000000001s",
+		"ORDER NEW time: 20200601-09:00:02, securityId: 154, netPosition: 50, latency: 1ms",
+		"ORDER CANCEL time: 20200601-09:00:03, securityId: 999, netPosition: 300, latency: 1ms",
+		"ORDER NEW time: 20200601-09:00:04, securityId: 999, netPosition: 40, latency: 2500000h",
+		"ORDER NEW time: 20200601-09:00:12, securityId: 154, netPosition: 90, latency: 1ms",
+	})
+	configFile := "delta_filterlogs.yaml"
+	mfs.SetFileData(configFile, strings.Split(`
+Apps:
+    - AppName: Orders
+      TimestampElement: TimeKey
+      LogLines:
+          - Tag: NEW
+            Patterns: ['ORDER NEW']
+            ExampleLine: 'ORDER NEW time: 20200601-09:00:00, securityId: 999, netPosition: 100, latency: 1ms'
+            Elements: &elements
+                TimeKey: {StartPattern: 'time: ', EndPattern: ',', Type: timestamp, Layout: '20060102-15:04:05'}
+                SecurityIdKey: {ColumnName: securityId, StartPattern: 'securityId: ', EndPattern: ','}
+                NetPositionKey: {ColumnName: netPosition, StartPattern: 'netPosition: ', EndPattern: ',', Type: int}
+                LatencyKey: {ColumnName: latency, StartPattern: 'latency: ', EndPattern: '$', Type: duration}
+          - Tag: CANCEL
+            Patterns: ['ORDER CANCEL']
+            ExampleLine: 'ORDER CANCEL time: 20200601-09:00:03, securityId: 999, netPosition: 300, latency: 1ms'
+            Elements: *elements
+      DeltaColumns:
+`+deltaColumns, "\n"))
+
+	records := []string{}
+	app := filterlogs.NewApp([]string{"delta.log"}, configFile, []string{}, false)
+	app.Run(func(config *filterlogs.ClientConfigType, filteredData map[string]*filterlogs.FilteredData) {
+		if filteredData["DeltaKey"] == nil {
+			records = append(records, "N/A")
+		} else {
+			records = append(records, filteredData["DeltaKey"].Text)
+		}
+	})
+	return records
+}
+
+func Test_DeltaColumns_are_the_change_since_the_previous_record(t *testing.T) {
+	assert.Equal(t, []string{"N/A", "-50", "250", "-260", "50"},
+		runDeltaApp(t, "          - {ElementKey: DeltaKey, Of: netPosition}"))
+	// previous record of the same securityId and tag
+	assert.Equal(t, []string{"N/A", "N/A", "N/A", "-60", "40"},
+		runDeltaApp(t, "          - {ElementKey: DeltaKey, Of: NetPositionKey, PartitionBy: securityId, Tags: [NEW]}"))
+	assert.Equal(t, []string{"N/A", "N/A", "3s", "1s", "10s"},
+		runDeltaApp(t, "          - {ElementKey: DeltaKey, Of: TimeKey, PartitionBy: securityId, Unit: duration}"))
+	// large durations are not rounded
+	assert.Equal(t, []string{"N/A", "N/A", "N/A", "-1ns", "0s"},
+		runDeltaApp(t, "          - {ElementKey: DeltaKey, Of: latency, PartitionBy: securityId, Tags: [NEW]}"))
+	assert.Equal(t, []string{"N/A", "N/A", "66.66666666666667", "-260", "4"},
+		runDeltaApp(t, "          - {ElementKey: DeltaKey, Of: netPosition, PartitionBy: securityId, Unit: rate}"))
+	// delta columns can be used in Where, the records dropped by Where are still compared
+	assert.Equal(t, []string{"250", "50"},
+		runDeltaApp(t, "          - {ElementKey: DeltaKey, Of: netPosition}\n      Where: 'DeltaKey > 0'"))
+
+	captureStdout()
+	assert.Empty(t, runDeltaApp(t, "          - {ElementKey: DeltaKey, Of: TimeKey}"))
+	assert.Contains(t, getCapturedStdout(), "please use Unit duration for the timestamp TimeKey")
+}
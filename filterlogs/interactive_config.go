@@ -52,6 +52,9 @@ func showConfig(config *Config) {
 {{ .FormattedExampleLine }}
   {{ printf "%-25v" "Tag" | faint }}: {{ .Tag }}
   {{ printf "%-25v" "Patterns" | faint }}: {{ range .Patterns }}"{{.}}" {{end}}
+  {{- if .Regex }}
+  {{ printf "%-25v" "Regex" | faint }}: "{{ .Regex }}"
+  {{- end }}
   {{ range $k, $v := .Elements }} 
 	  {{- printf "- %-23v" $k | faint}}: {{ $v.Formatted }}
   {{end}}
@@ -1,9 +1,12 @@
 package filterlogs
 
 import (
+	"fmt"
 	"os"
+	"regexp"
 	"strings"
 
+	"github.com/Knetic/govaluate"
 	"github.com/manifoldco/promptui"
 	"github.com/muesli/reflow/wordwrap"
 	"golang.org/x/crypto/ssh/terminal"
@@ -16,12 +19,125 @@ type LogLineConfig struct {
 	Patterns    []string                  `yaml:"Patterns"`
 	ExampleLine string                    `yaml:"ExampleLine"`
 	Elements    map[string]*ElementConfig `yaml:"Elements"`
+	// Regex extracts the elements using named capturing groups, e.g. 'side: (?P<SideKey>\w+)' extracts the element
+	// SideKey. Elements config is optional for these element keys, it can be used to provide ColumnName and AllowEmpty.
+	Regex string `yaml:"Regex"`
+	// Where keeps only the loglines for which the expression on their elements is true, e.g. 'quantity > 500'. In the
+	// apps with blocks, the loglines which do not match are not added to their blocks.
+	Where string `yaml:"Where"`
 
 	// TODO, later on we can rename Elements with Columns and ColumnConfig if required. It is also possible that each
 	// element does not result in a column
+	regex                     *regexp.Regexp
+	whereExpression           *govaluate.EvaluableExpression
+	elementColumnNames        map[string]string // column names of the Elements, key is element key
 	cachedFormattedLineConfig string
 }
 
+// compileRegex compiles the Regex of the logline, nothing is done if Regex is not provided
+func (logline *LogLineConfig) compileRegex() error {
+	if len(logline.Regex) == 0 || logline.regex != nil {
+		return nil
+	}
+	regex, err := regexp.Compile(logline.Regex)
+	if err != nil {
+		return err
+	}
+	logline.regex = regex
+	return nil
+}
+
+// regexElementKeys returns the names of the capturing groups of Regex in the order of their appearance
+func (logline *LogLineConfig) regexElementKeys() []string {
+	elementKeys := []string{}
+	if logline.regex == nil {
+		return elementKeys
+	}
+	for _, name := range logline.regex.SubexpNames() {
+		if len(name) > 0 {
+			elementKeys = append(elementKeys, name)
+		}
+	}
+	return elementKeys
+}
+
+// typeError is returned when a value cannot be parsed into the Type of its element and the OnTypeError policy of the
+// element is drop or abort
+type typeError struct {
+	elementKey string
+	text       string
+	policy     string
+	err        error
+}
+
+func (e *typeError) Error() string {
+	return fmt.Sprintf("cannot parse value %q of element %s, %v", e.text, e.elementKey, e.err)
+}
+
+// extractValues returns the values of all the elements found in the line, key is the element key. Values are parsed
+// into the Type of their elements as per the OnTypeError policy of the elements.
+func (logline *LogLineConfig) extractValues(line string) (map[string]*FilteredData, error) {
+	values := make(map[string]*FilteredData)
+	addValue := func(elementKey, text string) error {
+		if logline.TrimSpaces {
+			text = strings.TrimSpace(text)
+		}
+		ele, exists := logline.Elements[elementKey]
+		if (!exists || !ele.AllowEmpty) && len(text) == 0 {
+			text = NotFound
+		}
+		filteredData := &FilteredData{Text: text}
+		values[elementKey] = filteredData
+		if !exists || len(ele.Type) == 0 || text == NotFound || len(text) == 0 {
+			return nil
+		}
+
+		value, err := ele.parseValue(text)
+		if err == nil {
+			filteredData.Value = value
+			return nil
+		}
+		switch ele.OnTypeError {
+		case gOnTypeErrorNF:
+			filteredData.Text = NotFound
+		case gOnTypeErrorDrop, gOnTypeErrorAbort:
+			return &typeError{elementKey: elementKey, text: text, policy: ele.OnTypeError, err: err}
+		}
+		return nil
+	}
+
+	for elementKey, ele := range logline.Elements {
+		if ele.isRegexGroup {
+			continue
+		}
+		text, found := ele.extract(line)
+		// continue if the element is not found
+		if !found {
+			continue
+		}
+		if err := addValue(elementKey, text); err != nil {
+			return nil, err
+		}
+	}
+
+	if logline.regex != nil {
+		loc := logline.regex.FindStringSubmatchIndex(line)
+		if loc == nil {
+			return values, nil
+		}
+		for i, elementKey := range logline.regex.SubexpNames() {
+			// skip the full match, unnamed and unmatched groups
+			if i == 0 || len(elementKey) == 0 || loc[2*i] < 0 {
+				continue
+			}
+			if err := addValue(elementKey, line[loc[2*i]:loc[2*i+1]]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return values, nil
+}
+
 // FormattedExampleLine returns the example log line formatted with config patterns
 func (logline *LogLineConfig) FormattedExampleLine() string {
 	if len(logline.cachedFormattedLineConfig) > 0 {
@@ -38,45 +154,20 @@ func (logline *LogLineConfig) FormattedLine(inputLine string) string {
 	green := promptui.Styler(promptui.FGGreen, promptui.FGBold)
 
 	line := inputLine
+	if logline.regex != nil {
+		line = logline.formatRegexGroups(line, red, green)
+	}
 	for _, ele := range logline.Elements {
-
-		startPat := ele.StartPattern
-		startIdx := 0
-		if startPat == gStartOfLine {
-			startPat = ""
-			startIdx = 0
-		} else {
-			startIdx = strings.Index(line, startPat)
-		}
-		// continue if the StartPattern is not found
-		if startIdx < 0 {
+		if ele.isRegexGroup {
 			continue
 		}
-
-		if len(ele.EndPattern) > 0 {
-			endPat := ""
-			endIdx := len(line)
-			if ele.EndPattern != gEndOfLine {
-				endPat = ele.EndPattern
-				idx := strings.Index(line[startIdx+len(startPat):], endPat)
-				// continue if EndPattern is not found
-				if endIdx < 0 {
-					continue
-				}
-				endIdx = startIdx + idx + len(startPat)
-			}
-			result := line[startIdx+len(startPat) : endIdx]
-			line = line[:startIdx] + red(startPat) + green(result) + red(endPat) + line[endIdx+len(endPat):]
-		} else if ele.PatternLength > 0 {
-			if ele.PatternLength >= len(line) {
-				// return if PatternLength is more than the length of the line
-				// TODO, write testcases for this
-				continue
-			}
-			endIdx := startIdx + len(startPat) + ele.PatternLength + 1
-			result := line[startIdx+len(startPat) : endIdx]
-			line = line[:startIdx] + red(startPat) + green(result) + line[endIdx:]
+		matchStart, valueStart, valueEnd, matchEnd, found := ele.locate(line)
+		// continue if the element is not found
+		if !found {
+			continue
 		}
+		line = line[:matchStart] + red(line[matchStart:valueStart]) + green(line[valueStart:valueEnd]) +
+			red(line[valueEnd:matchEnd]) + line[matchEnd:]
 	}
 
 	width, _, err := terminal.GetSize(int(os.Stdout.Fd()))
@@ -85,3 +176,22 @@ func (logline *LogLineConfig) FormattedLine(inputLine string) string {
 	}
 	return line
 }
+
+// formatRegexGroups highlights the named capturing groups of the logline Regex, nested groups are not highlighted
+func (logline *LogLineConfig) formatRegexGroups(line string, red, green func(interface{}) string) string {
+	loc := logline.regex.FindStringSubmatchIndex(line)
+	if loc == nil {
+		return line
+	}
+	output := line[:loc[0]]
+	pos := loc[0]
+	for i, name := range logline.regex.SubexpNames() {
+		// skip the full match, unnamed, unmatched and nested groups
+		if i == 0 || len(name) == 0 || loc[2*i] < pos {
+			continue
+		}
+		output += red(line[pos:loc[2*i]]) + green(line[loc[2*i]:loc[2*i+1]])
+		pos = loc[2*i+1]
+	}
+	return output + red(line[pos:loc[1]]) + line[loc[1]:]
+}
@@ -0,0 +1,213 @@
+package filterlogs
+
+import (
+	"fmt"
+	"time"
+)
+
+// gTimeRangeLayouts are the layouts accepted for Since and Until
+var gTimeRangeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// gTimeOfDayLayouts are the layouts of Since and Until which only compare the time of the day of the records, e.g. to
+// pick the market hours from the logs of several days
+var gTimeOfDayLayouts = []string{
+	"15:04:05.999999999",
+	"15:04",
+}
+
+// timeRange is the window [since, until) of the record timestamps, a zero bound is not checked
+type timeRange struct {
+	since, until time.Time
+	// timeOfDay compares only the time of the day, since can be after until for a window crossing midnight
+	timeOfDay bool
+}
+
+// parseTimeBound parses Since or Until, true is returned if only the time of the day is given
+func parseTimeBound(bound string) (time.Time, bool, error) {
+	for _, layout := range gTimeRangeLayouts {
+		if t, err := time.Parse(layout, bound); err == nil {
+			return t, false, nil
+		}
+	}
+	for _, layout := range gTimeOfDayLayouts {
+		if t, err := time.Parse(layout, bound); err == nil {
+			return t, true, nil
+		}
+	}
+	return time.Time{}, false, fmt.Errorf("cannot parse %q, e.g. '2020-12-31 09:15:00', '2020-12-31T09:15:00Z' or '09:15'",
+		bound)
+}
+
+func newTimeRange(since, until string) (*timeRange, error) {
+	if len(since) == 0 && len(until) == 0 {
+		return nil, nil
+	}
+	tr := &timeRange{}
+	sinceTimeOfDay, untilTimeOfDay := false, false
+	var err error
+	if len(since) > 0 {
+		if tr.since, sinceTimeOfDay, err = parseTimeBound(since); err != nil {
+			return nil, fmt.Errorf("invalid Since, %s", err)
+		}
+	}
+	if len(until) > 0 {
+		if tr.until, untilTimeOfDay, err = parseTimeBound(until); err != nil {
+			return nil, fmt.Errorf("invalid Until, %s", err)
+		}
+	}
+	if len(since) > 0 && len(until) > 0 {
+		if sinceTimeOfDay != untilTimeOfDay {
+			return nil, fmt.Errorf("Since %q and Until %q must both be a time of the day or both be a date", since, until)
+		}
+		if !sinceTimeOfDay && !tr.since.Before(tr.until) {
+			return nil, fmt.Errorf("Since %q must be before Until %q", since, until)
+		}
+	}
+	tr.timeOfDay = sinceTimeOfDay || untilTimeOfDay
+	return tr, nil
+}
+
+// timeOfDay returns the duration since the midnight of t
+func timeOfDay(t time.Time) time.Duration {
+	hour, min, sec := t.Clock()
+	return time.Duration(hour)*time.Hour + time.Duration(min)*time.Minute + time.Duration(sec)*time.Second +
+		time.Duration(t.Nanosecond())
+}
+
+// position returns -1 if t is before the range, 0 if it is in the range and 1 if it is after the range. Times of the
+// day are never after the range as the next day can be in the range again.
+func (tr *timeRange) position(t time.Time) int {
+	if tr.timeOfDay {
+		clock := timeOfDay(t)
+		since, until := timeOfDay(tr.since), timeOfDay(tr.until)
+		switch {
+		case tr.since.IsZero():
+			if clock < until {
+				return 0
+			}
+		case tr.until.IsZero():
+			if clock >= since {
+				return 0
+			}
+		case since <= until:
+			if clock >= since && clock < until {
+				return 0
+			}
+		default:
+			// window crosses the midnight, e.g. 22:00 to 02:00
+			if clock >= since || clock < until {
+				return 0
+			}
+		}
+		return -1
+	}
+	if !tr.since.IsZero() && t.Before(tr.since) {
+		return -1
+	}
+	if !tr.until.IsZero() && !t.Before(tr.until) {
+		return 1
+	}
+	return 0
+}
+
+// lineRangeFunc returns the function used by the logparser to seek the input files to Since and to stop reading them
+// at Until using LineTimestamp. It is nil if the loglines outside of the range can be a part of a record in the range,
+// i.e. an app uses its own TimestampElement or blocks, or if only the time of the day is given which can be found on
+// any day.
+func (config *Config) lineRangeFunc() func(line string) (int, bool) {
+	if config.LineTimestamp == nil || len(config.Apps) == 0 {
+		return nil
+	}
+	tr := config.Apps[0].timeRange
+	if tr == nil || tr.timeOfDay {
+		return nil
+	}
+	for _, appconfig := range config.Apps {
+		if len(appconfig.TimestampElement) > 0 || appconfig.hasStartBlockPattern || appconfig.hasEndBlockPattern {
+			return nil
+		}
+	}
+	return func(line string) (int, bool) {
+		ts, ok := config.LineTimestamp.parse(line)
+		if !ok {
+			return 0, false
+		}
+		return tr.position(ts), true
+	}
+}
+
+// recordTimestamp returns the timestamp of a record from the TimestampElement of the app or from the LineTimestamp of
+// its first logline, false is returned if the timestamp is not found
+func (appconfig *AppConfig) recordTimestamp(values map[string]*FilteredData, line string) (time.Time, bool) {
+	if len(appconfig.TimestampElement) == 0 {
+		return appconfig.lineTimestamp.parse(line)
+	}
+	filteredData, found := values[appconfig.TimestampElement]
+	if !found || filteredData == nil {
+		return time.Time{}, false
+	}
+	if ts, ok := filteredData.Value.(time.Time); ok {
+		return ts, true
+	}
+	ts, err := time.Parse(appconfig.TimestampLayout, filteredData.Text)
+	return ts, err == nil
+}
+
+// inTimeRange returns true if the record is inside the time range, records without a timestamp are dropped when a
+// time range is given
+func (appconfig *AppConfig) inTimeRange(values map[string]*FilteredData, line string) bool {
+	if appconfig.timeRange == nil {
+		return true
+	}
+	ts, ok := appconfig.recordTimestamp(values, line)
+	return ok && appconfig.timeRange.position(ts) == 0
+}
+
+// verifyTimeRange parses Since and Until and finds the timestamp used by each app to filter its records
+func (config *Config) verifyTimeRange() bool {
+	tr, err := newTimeRange(config.Since, config.Until)
+	if err != nil {
+		fmt.Println("ERROR,", err)
+		return false
+	}
+	for _, appconfig := range config.Apps {
+		if len(appconfig.TimestampElement) > 0 {
+			ele := appconfig.findElement(appconfig.TimestampElement)
+			if ele == nil {
+				fmt.Println("TimestampElement", appconfig.TimestampElement, "is not an element of the app", appconfig.AppName)
+				return false
+			}
+			if len(appconfig.TimestampLayout) == 0 && ele.Type == TypeTimestamp {
+				appconfig.TimestampLayout = ele.Layout
+			}
+			if len(appconfig.TimestampLayout) == 0 {
+				fmt.Println("Please provide the TimestampLayout of the app", appconfig.AppName,
+					"or Type timestamp for its TimestampElement", appconfig.TimestampElement)
+				return false
+			}
+		} else if tr != nil && config.LineTimestamp == nil {
+			fmt.Println("Please provide the TimestampElement of the app", appconfig.AppName,
+				"or LineTimestamp to filter the records by Since and Until")
+			return false
+		}
+		appconfig.timeRange = tr
+		appconfig.lineTimestamp = config.LineTimestamp
+	}
+	return true
+}
+
+// findElement returns the config of the element from any logline of the app, nil is returned if it is not found
+func (appconfig *AppConfig) findElement(elementKey string) *ElementConfig {
+	for _, logline := range appconfig.LogLines {
+		if ele, found := logline.Elements[elementKey]; found && ele != nil {
+			return ele
+		}
+	}
+	return nil
+}
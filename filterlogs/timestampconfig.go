@@ -0,0 +1,55 @@
+package filterlogs
+
+import (
+	"fmt"
+	"time"
+)
+
+// TimestampConfig stores the config to extract a timestamp from a logline and parse it using the Layout. Layout follows
+// the reference time of golang's time package, e.g. '2006-01-02 15:04:05.000000'
+type TimestampConfig struct {
+	ElementConfig `yaml:",inline"`
+}
+
+// parse extracts the timestamp from the line, false is returned if the timestamp is not found or cannot be parsed
+func (tc *TimestampConfig) parse(line string) (time.Time, bool) {
+	text, found := tc.extract(line)
+	if !found {
+		return time.Time{}, false
+	}
+	ts, err := time.Parse(tc.Layout, text)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return ts, true
+}
+
+// less compares the loglines by their timestamps. Lines without a timestamp are considered the smallest so that the
+// continuation lines (e.g. stack traces) stay together with the lines preceding them in the same source.
+func (tc *TimestampConfig) less(line1, line2 string) bool {
+	ts1, _ := tc.parse(line1)
+	ts2, _ := tc.parse(line2)
+	return ts1.Before(ts2)
+}
+
+func (tc *TimestampConfig) verify(name string, exampleLines []string) bool {
+	if len(tc.StartPattern) == 0 && len(tc.Regex) == 0 {
+		fmt.Println("Please provide the StartPattern or Regex in", name, "config", tc.Formatted())
+		return false
+	}
+	if err := tc.compileRegex(); err != nil {
+		fmt.Println("Cannot compile Regex of", name, "config", tc.Regex, err)
+		return false
+	}
+	if len(tc.Layout) == 0 {
+		fmt.Println("Please provide the Layout in", name, "config, e.g. '2006-01-02 15:04:05.000000'", tc.Formatted())
+		return false
+	}
+	for _, exampleLine := range exampleLines {
+		if _, ok := tc.parse(exampleLine); !ok {
+			fmt.Println(name, "cannot be parsed from the ExampleLine, Layout:", tc.Layout, tc.Formatted(), exampleLine)
+			return false
+		}
+	}
+	return true
+}
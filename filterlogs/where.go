@@ -0,0 +1,217 @@
+package filterlogs
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Knetic/govaluate"
+)
+
+// rewriteInLists rewrites the lists of the in operator into the syntax of govaluate, e.g. 'securityId in [999, 154]'
+// becomes 'securityId IN (999, 154)'. Quoted strings are not changed. govaluate reads a list of a single value as a
+// value in parentheses, so the value is repeated, e.g. 'side in ['BUY']' becomes "side IN ('BUY', 'BUY')".
+func rewriteInLists(where string) string {
+	var sb, list strings.Builder
+	quote := rune(0)
+	inList, hasComma := false, false
+	runes := []rune(where)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		out := &sb
+		if inList {
+			out = &list
+		}
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case inList && r == ',':
+			hasComma = true
+		case inList && r == ']':
+			values := list.String()
+			if !hasComma && len(strings.TrimSpace(values)) > 0 {
+				values += ", " + values
+			}
+			sb.WriteString("IN (" + values + ")")
+			list.Reset()
+			inList = false
+			continue
+		case !inList && (r == 'i' || r == 'I') && isInOperator(runes, i):
+			// skip the spaces between the operator and the list
+			for runes[i] != '[' {
+				i++
+			}
+			inList, hasComma = true, false
+			continue
+		}
+		out.WriteRune(r)
+	}
+	if inList {
+		// list is not closed, it is reported by govaluate
+		sb.WriteString("IN (" + list.String())
+	}
+	return sb.String()
+}
+
+// isInOperator returns true if the word in starts at i and it is followed by a list, e.g. 'in [1, 2]'
+func isInOperator(runes []rune, i int) bool {
+	if i+2 >= len(runes) || !strings.EqualFold(string(runes[i:i+2]), "in") {
+		return false
+	}
+	if i > 0 && isIdentifierRune(runes[i-1]) {
+		return false
+	}
+	for j := i + 2; j < len(runes); j++ {
+		switch runes[j] {
+		case ' ', '\t':
+			continue
+		case '[':
+			return true
+		}
+		return false
+	}
+	return false
+}
+
+func isIdentifierRune(r rune) bool {
+	return r == '_' || r == '.' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9')
+}
+
+// compileWhere compiles the Where clause and verifies that its parameters are known
+func compileWhere(where string, knownKeys map[string]bool) (*govaluate.EvaluableExpression, error) {
+	expression, err := govaluate.NewEvaluableExpressionWithFunctions(rewriteInLists(where), gExpressionFunctions)
+	if err != nil {
+		return nil, err
+	}
+	for _, variable := range expression.Vars() {
+		if !knownKeys[variable] {
+			return nil, fmt.Errorf("unknown element %q in Where %q", variable, where)
+		}
+	}
+	return expression, nil
+}
+
+// matchesWhere returns true if all the expressions evaluate to true for the values. A record does not match if an
+// element used in an expression is not found or the expression cannot be evaluated.
+func matchesWhere(expressions []*govaluate.EvaluableExpression, columnNames map[string]string,
+	values map[string]*FilteredData) bool {
+	if len(expressions) == 0 {
+		return true
+	}
+	ep := newExpressionParameters(columnNames, values)
+	for _, expression := range expressions {
+		result, err := expression.Evaluate(ep.parameters)
+		if matched, ok := result.(bool); err != nil || !ok || !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// knownKeys returns the element keys and the column names of the elements and the computed columns of the app
+func (appconfig *AppConfig) knownKeys() map[string]bool {
+	knownKeys := map[string]bool{}
+	for _, metaInfo := range appconfig.metaInfo {
+		knownKeys[metaInfo.ElementKey] = true
+		if len(metaInfo.ColumnName) > 0 {
+			knownKeys[metaInfo.ColumnName] = true
+		}
+	}
+	return knownKeys
+}
+
+// columnNames returns the column names of the elements of the logline, key is element key
+func (logline *LogLineConfig) columnNames() map[string]string {
+	columnNames := map[string]string{}
+	for eleKey, ele := range logline.Elements {
+		if len(ele.ColumnName) > 0 {
+			columnNames[eleKey] = ele.ColumnName
+		}
+	}
+	return columnNames
+}
+
+// verifyWhere compiles the Where clauses of the app and its loglines. It is called after adding the computed columns
+// to the MetaInfo. Column names used to evaluate the expressions of each record are also stored.
+func (appconfig *AppConfig) verifyWhere() bool {
+	appconfig.elementColumnNames = appconfig.columnNames()
+	if len(appconfig.Where) > 0 {
+		expression, err := compileWhere(appconfig.Where, appconfig.knownKeys())
+		if err != nil {
+			fmt.Println("Invalid Where config,", err, appconfig.AppName)
+			return false
+		}
+		appconfig.whereExpressions = append(appconfig.whereExpressions, expression)
+	}
+	for _, logline := range appconfig.LogLines {
+		if len(logline.Where) == 0 {
+			continue
+		}
+		logline.elementColumnNames = logline.columnNames()
+		knownKeys := map[string]bool{}
+		for _, columnName := range logline.elementColumnNames {
+			knownKeys[columnName] = true
+		}
+		for eleKey := range logline.Elements {
+			knownKeys[eleKey] = true
+		}
+		for _, eleKey := range logline.regexElementKeys() {
+			knownKeys[eleKey] = true
+		}
+		expression, err := compileWhere(logline.Where, knownKeys)
+		if err != nil {
+			fmt.Println("Invalid Where config,", err, appconfig.AppName, logline.Tag)
+			return false
+		}
+		logline.whereExpression = expression
+	}
+	return true
+}
+
+// addWhere adds a Where clause to the apps which have all the elements used in it, e.g. given by --where. Records of
+// the other apps are dropped unless keepOtherApps is set, a warning is printed for each of them. It returns false if
+// the clause is invalid or no app has all its elements.
+func (config *Config) addWhere(where string, keepOtherApps bool) bool {
+	added := false
+	var lastErr error
+	otherApps := []*AppConfig{}
+	for _, appconfig := range config.Apps {
+		expression, err := compileWhere(where, appconfig.knownKeys())
+		if err != nil {
+			lastErr = err
+			otherApps = append(otherApps, appconfig)
+			continue
+		}
+		appconfig.whereExpressions = append(appconfig.whereExpressions, expression)
+		added = true
+	}
+	if !added {
+		fmt.Println("ERROR, Where cannot be applied to any app,", lastErr)
+		return false
+	}
+	for _, appconfig := range otherApps {
+		if keepOtherApps {
+			fmt.Println("WARN, Where is not applied to app", appconfig.AppName, "as it does not have all the elements used in", where)
+			continue
+		}
+		fmt.Println("WARN, records of app", appconfig.AppName, "are dropped as it does not have all the elements used in Where", where)
+		appconfig.droppedByWhere = true
+	}
+	return true
+}
+
+// matchesWhere returns true if the record passes the Where clauses of the app
+func (appconfig *AppConfig) matchesWhere(values map[string]*FilteredData) bool {
+	return matchesWhere(appconfig.whereExpressions, appconfig.elementColumnNames, values)
+}
+
+// matchesWhere returns true if the values extracted from the line pass the Where clause of the logline
+func (logline *LogLineConfig) matchesWhere(values map[string]*FilteredData) bool {
+	if logline.whereExpression == nil {
+		return true
+	}
+	return matchesWhere([]*govaluate.EvaluableExpression{logline.whereExpression}, logline.elementColumnNames, values)
+}
@@ -5,8 +5,14 @@ package logparser
 import (
 	"fmt"
 	"github.com/parmaanu/goutils/algoutils"
+	"io"
+	"os"
+	"sync"
 )
 
+// StdinSource is the source name of the lines read from stdin
+const StdinSource = "-"
+
 // LineParsingConfig is passed in LineParsingFunc which is called for every line
 type LineParsingConfig struct {
 	Line string
@@ -19,6 +25,7 @@ type OnEachLineConfig struct {
 	Line string
 	Pat  string
 	Data []string
+	Info LineInfo
 }
 
 // Config depicts the each element config and a specific action
@@ -30,11 +37,16 @@ type Config struct {
 
 // LogParser is the main struct will contains the patterns and the different sources
 type LogParser struct {
-	mslr     MultiSourceLineReader
-	patterns []*Config
+	mslr      MultiSourceLineReader
+	tailers   []*TailLineReader
+	patterns  []*Config
+	rangeFunc func(line string) (int, bool)
+
+	stop     chan struct{}
+	stopOnce sync.Once
 }
 
-func (lp *LogParser) processLine(line string) {
+func (lp *LogParser) processLine(line string, info LineInfo) {
 	for _, config := range lp.patterns {
 		if !algoutils.StringContainsAll(line, config.Patterns) {
 			continue
@@ -57,6 +69,7 @@ func (lp *LogParser) processLine(line string) {
 				Line: line,
 				Pat:  config.Patterns[0],
 				Data: data,
+				Info: info,
 			})
 		}
 		// break if you found any pattern
@@ -64,28 +77,195 @@ func (lp *LogParser) processLine(line string) {
 	}
 }
 
-// Run starts the processing of different sources
+// Run starts the processing of different sources. It returns when all the sources are read or the LogParser is
+// stopped. If tail sources are added then Run keeps on following them until Stop is called.
 func (lp *LogParser) Run() {
+	if len(lp.tailers) > 0 {
+		lp.runFollow()
+		return
+	}
+	// lines which cannot be compared with the range, e.g. continuation lines, have the position of the previous line
+	linePosition := 0
 	nextLine, err := lp.mslr.NextLine()
 	for err != -1 {
-		lp.processLine(nextLine)
+		select {
+		case <-lp.stop:
+			return
+		default:
+		}
+		if lp.rangeFunc != nil {
+			if position, ok := lp.rangeFunc(nextLine); ok {
+				linePosition = position
+			}
+			// lines are in order, so the rest of the lines are also after the range
+			if linePosition > 0 {
+				return
+			}
+		}
+		if linePosition == 0 {
+			lp.processLine(nextLine, lp.mslr.LastLineInfo())
+		}
 		nextLine, err = lp.mslr.NextLine()
 	}
 }
 
+// sourceLine is a line along with its LineInfo, it is used to pass the lines of the followed sources
+type sourceLine struct {
+	line string
+	info LineInfo
+}
+
+// runFollow processes the lines of the tail sources in the order they are written. Since the files keep on growing,
+// lines cannot be merged in sorted order across the sources. Other sources (e.g. stdin) are read alongside the tail
+// sources.
+func (lp *LogParser) runFollow() {
+	lines := make(chan sourceLine)
+	// reading from the other sources may block (e.g. stdin) even after stop, so lines is closed without waiting for
+	// them once stopped. closed is guarded by mu so that they do not send a line after lines is closed.
+	var mu sync.Mutex
+	closed := false
+	mslrDone := make(chan struct{})
+	if len(lp.mslr.Sources) > 0 {
+		go func() {
+			defer close(mslrDone)
+			nextLine, err := lp.mslr.NextLine()
+			for err != -1 {
+				mu.Lock()
+				if closed {
+					mu.Unlock()
+					return
+				}
+				lines <- sourceLine{line: nextLine, info: lp.mslr.LastLineInfo()}
+				mu.Unlock()
+				select {
+				case <-lp.stop:
+					return
+				default:
+				}
+				nextLine, err = lp.mslr.NextLine()
+			}
+		}()
+	} else {
+		close(mslrDone)
+	}
+	var wg sync.WaitGroup
+	for _, tlr := range lp.tailers {
+		wg.Add(1)
+		go func(tlr *TailLineReader) {
+			defer wg.Done()
+			defer tlr.Close()
+			for {
+				// partial last line is returned along with io.EOF when the reader is stopped
+				line, err := tlr.NextLine()
+				if err == nil || (err == io.EOF && len(line) > 0) {
+					lines <- sourceLine{line: line, info: LineInfo{Source: tlr.Filename, LineNo: tlr.LineNo, Offset: tlr.LineOffset()}}
+				}
+				if err != nil {
+					return
+				}
+			}
+		}(tlr)
+	}
+	go func() {
+		// tail readers return once stopped
+		wg.Wait()
+		select {
+		case <-mslrDone:
+		case <-lp.stop:
+		}
+		mu.Lock()
+		closed = true
+		close(lines)
+		mu.Unlock()
+	}()
+
+	// lines read before stop are processed so that the records found till now are not lost
+	for line := range lines {
+		lp.processLine(line.line, line.info)
+	}
+}
+
+// Stop stops the processing of the sources, it is safe to call Stop multiple times and from other goroutines
+func (lp *LogParser) Stop() {
+	lp.stopOnce.Do(func() {
+		close(lp.stop)
+	})
+}
+
 // AddFileSources takes a list of filenames and created FileLineReader for
 // reading from those files
 func (lp *LogParser) AddFileSources(filenames ...string) {
 	for _, filename := range filenames {
 		flr, err := NewFileLineReader(filename)
+		if err != nil {
+			fmt.Println("Failed to create FLR err ", err)
+			continue
+		}
+		if lp.rangeFunc != nil {
+			err = flr.seekToFirstLine(func(line string) (bool, bool) {
+				position, ok := lp.rangeFunc(line)
+				return position >= 0, ok
+			})
+			if err != nil {
+				// file is read from the beginning and the lines before the range are skipped
+				fmt.Println("Failed to seek FLR err ", err)
+				flr.Close()
+				if flr, err = NewFileLineReader(filename); err != nil {
+					fmt.Println("Failed to create FLR err ", err)
+					continue
+				}
+			}
+		}
+		lp.mslr.AddSources(flr)
+	}
+}
+
+// AddReaderSources takes a list of io.Readers like stdin and creates ReaderLineReader for reading from them. Lines
+// read from stdin have "-" as their source.
+func (lp *LogParser) AddReaderSources(readers ...io.Reader) {
+	for _, reader := range readers {
+		name := ""
+		if reader == os.Stdin {
+			name = StdinSource
+		}
+		rlr, err := NewReaderLineReader(reader, name)
 		if err == nil {
-			lp.mslr.AddSources(flr)
+			lp.mslr.AddSources(rlr)
 		} else {
-			fmt.Println("Failed to create FLR err ", err)
+			fmt.Println("Failed to create RLR err ", err)
 		}
 	}
 }
 
+// AddTailSources takes a list of filenames and creates TailLineReader for following those files until the LogParser is
+// stopped
+func (lp *LogParser) AddTailSources(filenames ...string) {
+	for _, filename := range filenames {
+		tlr, err := NewTailLineReader(filename, lp.stop)
+		if err == nil {
+			lp.tailers = append(lp.tailers, tlr)
+		} else {
+			fmt.Println("Failed to create TLR err ", err)
+		}
+	}
+}
+
+// SetLineRangeFunc sets the function which returns the position of a line with respect to a range of lines, e.g. a
+// time range. Position is -1 if the line is before the range, 0 if it is in the range and 1 if it is after the range.
+// It returns false if the line cannot be compared, e.g. a continuation line without a timestamp. Lines outside of the
+// range are not processed. The sources must be in order, so the files are seeked to the start of the range and the
+// reading stops at the end of the range. It must be called before adding the sources, it is not used for the tail
+// sources.
+func (lp *LogParser) SetLineRangeFunc(rangeFunc func(line string) (int, bool)) {
+	lp.rangeFunc = rangeFunc
+}
+
+// SetLessFunc sets the function used to order the lines among the different sources. By default lines are ordered
+// lexicographically.
+func (lp *LogParser) SetLessFunc(less func(line1, line2 string) bool) {
+	lp.mslr.LessFunc = less
+}
+
 // AddConfig register the current config to list of patterns the
 // LogParser is interested in
 func (lp *LogParser) AddConfig(config Config) bool {
@@ -98,5 +278,7 @@ func (lp *LogParser) AddConfig(config Config) bool {
 
 // NewLogParser creats an instance of LogParser
 func NewLogParser() *LogParser {
-	return &LogParser{}
+	return &LogParser{
+		stop: make(chan struct{}),
+	}
 }
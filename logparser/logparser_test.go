@@ -1,9 +1,16 @@
 package logparser_test
 
 import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 	"tocsv/logparser"
 
 	"github.com/parmaanu/goutils/filesystem"
@@ -53,6 +60,33 @@ func init() {
 	}
 	mfs.SetFileData("file_large1.txt", fdata1)
 	mfs.SetFileData("file_large2.txt", fdata2)
+
+	// compressed files are read from the disk and stored as it is in the MockFileSystem
+	for _, fname := range []string{
+		"file_large1.txt", "file_large1.txt.gz", "file_large1.txt.bz2", "file_large1.txt.xz", "file_large1.txt.zst",
+		"file_large2.txt", "file_large2.txt.zst",
+	} {
+		data, err := ioutil.ReadFile("test_files/" + fname)
+		if err != nil {
+			panic(err)
+		}
+		mfs.SetFileData("test_files/"+fname, []string{string(data)})
+	}
+}
+
+func readAllLines(t *testing.T, lr logparser.LineReader) []string {
+	lines := []string{}
+	for {
+		line, err := lr.NextLine()
+		if lr.Finished() {
+			break
+		}
+		if err != nil && len(line) == 0 {
+			t.Fatal("error while reading line", err)
+		}
+		lines = append(lines, line)
+	}
+	return lines
 }
 
 func TestLogparser(t *testing.T) {
@@ -116,3 +150,280 @@ func TestMultiSourceLineReader(t *testing.T) {
 
 	assert.Equal(t, expectedLines, readLines)
 }
+
+func TestFileLineReaderWithCompressedFiles(t *testing.T) {
+	plain, err := logparser.NewFileLineReader("test_files/file_large1.txt")
+	assert.NoError(t, err)
+	expectedLines := readAllLines(t, plain)
+	assert.Equal(t, 103, len(expectedLines))
+
+	for _, fname := range []string{"file_large1.txt.gz", "file_large1.txt.bz2", "file_large1.txt.xz", "file_large1.txt.zst"} {
+		flr, err := logparser.NewFileLineReader("test_files/" + fname)
+		if !assert.NoError(t, err, fname) {
+			continue
+		}
+		assert.Equal(t, expectedLines, readAllLines(t, flr), fname)
+		assert.Equal(t, 103, flr.GetCurrentLineNumber(), fname)
+		flr.Close()
+	}
+}
+
+func TestMultiSourceLineReaderWithCompressedFiles(t *testing.T) {
+	readMerged := func(fnames ...string) []string {
+		mslr := logparser.NewMultiSourceLineReader()
+		for _, fname := range fnames {
+			flr, err := logparser.NewFileLineReader(fname)
+			assert.NoError(t, err, fname)
+			mslr.AddSources(flr)
+		}
+		lines := []string{}
+		for {
+			nextLine, err := mslr.NextLine()
+			if err == -1 {
+				break
+			}
+			lines = append(lines, nextLine)
+		}
+		return lines
+	}
+
+	expectedLines := readMerged("test_files/file_large1.txt", "test_files/file_large2.txt")
+	assert.Equal(t, 203, len(expectedLines))
+	assert.Equal(t, expectedLines, readMerged("test_files/file_large1.txt.gz", "test_files/file_large2.txt.zst"))
+}
+
+func TestTailLineReaderFollowsGrowingTruncatedAndRotatedFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tailreader")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fname := filepath.Join(dir, "app.log")
+	appendToFile := func(fname, data string) {
+		file, err := os.OpenFile(fname, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		assert.NoError(t, err)
+		file.WriteString(data)
+		file.Close()
+	}
+	appendToFile(fname, "line1\nline2\n")
+
+	stop := make(chan struct{})
+	tlr, err := logparser.NewTailLineReader(fname, stop)
+	assert.NoError(t, err)
+	tlr.PollInterval = time.Millisecond
+
+	lines := make(chan string, 10)
+	go func() {
+		for {
+			line, err := tlr.NextLine()
+			if err != nil {
+				close(lines)
+				return
+			}
+			lines <- line
+		}
+	}()
+	expectLine := func(expected string) {
+		select {
+		case line := <-lines:
+			assert.Equal(t, expected, line)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out while waiting for line:", expected)
+		}
+	}
+
+	expectLine("line1")
+	expectLine("line2")
+	assert.Equal(t, int64(6), tlr.LineOffset())
+
+	// lines are returned only after they are complete
+	appendToFile(fname, "line3\nli")
+	expectLine("line3")
+	appendToFile(fname, "ne4\n")
+	expectLine("line4")
+	assert.Equal(t, int64(18), tlr.LineOffset())
+
+	// truncated file is read from the beginning
+	assert.NoError(t, ioutil.WriteFile(fname, []byte("new1\n"), 0644))
+	expectLine("new1")
+	assert.Equal(t, 1, tlr.GetCurrentLineNumber())
+	assert.Equal(t, int64(0), tlr.LineOffset())
+
+	// renamed file is drained and the new file is read from the beginning
+	appendToFile(fname, "new2")
+	assert.NoError(t, os.Rename(fname, fname+".1"))
+	appendToFile(fname, "rotated1\n")
+	expectLine("new2")
+	expectLine("rotated1")
+	assert.Equal(t, 1, tlr.GetCurrentLineNumber())
+
+	close(stop)
+	select {
+	case _, ok := <-lines:
+		assert.False(t, ok, "no line is expected after stopping the reader")
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out while waiting for the reader to stop")
+	}
+	assert.True(t, tlr.Finished())
+}
+
+func TestLogparserProcessesFollowedLinesReadBeforeStop(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logparser_follow")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fname := filepath.Join(dir, "app.log")
+	assert.NoError(t, ioutil.WriteFile(fname, []byte("line1\nline2\npartial"), 0644))
+
+	lpr := logparser.NewLogParser()
+	lpr.AddTailSources(fname)
+	lines := make(chan string, 10)
+	lpr.AddConfig(logparser.Config{
+		Patterns: []string{"l"},
+		OnEachLineFunc: func(config *logparser.OnEachLineConfig) {
+			lines <- config.Line
+		},
+	})
+	done := make(chan struct{})
+	go func() {
+		lpr.Run()
+		close(done)
+	}()
+	for _, expected := range []string{"line1", "line2"} {
+		select {
+		case line := <-lines:
+			assert.Equal(t, expected, line)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out while waiting for line:", expected)
+		}
+	}
+
+	// partial last line is processed when the logparser is stopped
+	lpr.Stop()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out while waiting for the logparser to stop")
+	}
+	close(lines)
+	remaining := []string{}
+	for line := range lines {
+		remaining = append(remaining, line)
+	}
+	assert.Equal(t, []string{"partial"}, remaining)
+}
+
+func TestReaderLineReader(t *testing.T) {
+	expectedLines := []string{"line1", "tradelog, orderId=[123]", "line3"}
+
+	rlr, err := logparser.NewReaderLineReader(strings.NewReader(strings.Join(expectedLines, "\n")), "")
+	assert.NoError(t, err)
+	assert.Equal(t, expectedLines, readAllLines(t, rlr))
+	assert.Equal(t, 3, rlr.GetCurrentLineNumber())
+
+	// compressed input is also supported
+	var compressed bytes.Buffer
+	gzWriter := gzip.NewWriter(&compressed)
+	gzWriter.Write([]byte(strings.Join(expectedLines, "\n") + "\n"))
+	gzWriter.Close()
+
+	rlr, err = logparser.NewReaderLineReader(&compressed, "")
+	assert.NoError(t, err)
+	assert.Equal(t, expectedLines, readAllLines(t, rlr))
+}
+
+func TestLogparserWithReaderSources(t *testing.T) {
+	matchedLines := []string{}
+	lpr := logparser.NewLogParser()
+	lpr.AddReaderSources(strings.NewReader("ORDER qty:1\nEXEC qty:1\nORDER qty:2\n"))
+	lpr.AddConfig(logparser.Config{
+		Patterns: []string{"ORDER"},
+		OnEachLineFunc: func(config *logparser.OnEachLineConfig) {
+			matchedLines = append(matchedLines, config.Line)
+		},
+	})
+	lpr.Run()
+	assert.Equal(t, []string{"ORDER qty:1", "ORDER qty:2"}, matchedLines)
+}
+
+func TestMultiSourceLineReaderLastLineInfo(t *testing.T) {
+	mslr := logparser.NewMultiSourceLineReader()
+
+	file1, _ := logparser.NewFileLineReader("file1.txt")
+	file2, _ := logparser.NewFileLineReader("file2.txt")
+	mslr.AddSources(file1, file2)
+
+	expectedInfo := []logparser.LineInfo{
+		{Source: "file2.txt", LineNo: 1, Offset: 0},
+		{Source: "file1.txt", LineNo: 1, Offset: 0},
+		{Source: "file1.txt", LineNo: 2, Offset: 60},
+		{Source: "file2.txt", LineNo: 2, Offset: 39},
+		{Source: "file1.txt", LineNo: 3, Offset: 147},
+		{Source: "file1.txt", LineNo: 4, Offset: 213},
+		{Source: "file2.txt", LineNo: 3, Offset: 106},
+		{Source: "file2.txt", LineNo: 4, Offset: 156},
+	}
+	readInfo := []logparser.LineInfo{}
+	for {
+		_, err := mslr.NextLine()
+		if err == -1 {
+			break
+		}
+		readInfo = append(readInfo, mslr.LastLineInfo())
+	}
+	assert.Equal(t, expectedInfo, readInfo)
+}
+
+func TestLogparserWithLineRangeFunc(t *testing.T) {
+	// lines are ordered by their number, every 10th line is a continuation line without a number
+	fdata := []string{}
+	offsets := []int64{}
+	offset := int64(0)
+	for i := 0; i < 20000; i++ {
+		line := strconv.Itoa(1000000+i) + " ORDER qty:" + strconv.Itoa(i%100)
+		if i%10 == 9 {
+			line = "    continuation of the previous line"
+		}
+		fdata = append(fdata, line)
+		offsets = append(offsets, offset)
+		offset += int64(len(line)) + 1
+	}
+	mfs := filesystem.GetFileSystem().(*filesystem.MockFileSystem)
+	mfs.SetFileData("file_ordered.txt", fdata)
+
+	rangeFuncCalls := 0
+	lpr := logparser.NewLogParser()
+	lpr.SetLineRangeFunc(func(line string) (int, bool) {
+		rangeFuncCalls++
+		n, err := strconv.Atoi(strings.Fields(line)[0])
+		if err != nil {
+			return 0, false
+		}
+		switch {
+		case n < 1012345:
+			return -1, true
+		case n >= 1012400:
+			return 1, true
+		}
+		return 0, true
+	})
+	lpr.AddFileSources("file_ordered.txt")
+
+	matchedLines := []string{}
+	matchedInfo := []logparser.LineInfo{}
+	lpr.AddConfig(logparser.Config{
+		Patterns: []string{" "},
+		OnEachLineFunc: func(config *logparser.OnEachLineConfig) {
+			matchedLines = append(matchedLines, config.Line)
+			matchedInfo = append(matchedInfo, config.Info)
+		},
+	})
+	lpr.Run()
+
+	// lines 12345 to 12399 including the continuation lines are in the range
+	assert.Equal(t, fdata[12345:12400], matchedLines)
+	assert.Equal(t, logparser.LineInfo{Source: "file_ordered.txt", LineNo: 12346, Offset: offsets[12345]}, matchedInfo[0])
+	assert.Equal(t, logparser.LineInfo{Source: "file_ordered.txt", LineNo: 12400, Offset: offsets[12399]},
+		matchedInfo[len(matchedInfo)-1])
+	// the file is seeked to the start of the range and the reading stops at the end of the range
+	assert.Less(t, rangeFuncCalls, 10000)
+}
@@ -2,8 +2,22 @@ package logparser
 
 import (
 	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
 	"github.com/parmaanu/goutils/filesystem"
 	"io"
+	"io/ioutil"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh") // followed by the block size from '1' to '9'
+	xzMagic    = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
 )
 
 // LineReader defines a interfaces for reading from a source line by line
@@ -13,59 +27,169 @@ type LineReader interface {
 	Finished() bool
 }
 
-// FileLineReader implements a LineReader interface for Files
-type FileLineReader struct {
-	UnderlyingFile filesystem.File
-	Reader         *bufio.Reader
-	LineNo         int
-	EOFReached     bool
+// namedLineReader is implemented by the LineReaders which know the name of their source, e.g. the filename
+type namedLineReader interface {
+	SourceName() string
 }
 
-// TODO: Support gzip files
-// Will do as part of issue #10
-func (flr *FileLineReader) open(filepath string) error {
-	file, err := filesystem.Open(filepath)
+// offsetLineReader is implemented by the LineReaders which know the byte offset of the lines in their source
+type offsetLineReader interface {
+	LineOffset() int64
+}
+
+// LineInfo stores where a line is read from
+type LineInfo struct {
+	Source string // name of the source, e.g. the filename, empty if the source is unnamed
+	LineNo int    // line number in the source starting from 1
+	Offset int64  // byte offset of the start of the line in the source, offsets of compressed sources are in the decompressed data
+}
+
+// ReaderLineReader implements a LineReader interface for any io.Reader like stdin or a pipe
+// gzip, bzip2, xz and zstd compressed input is decompressed transparently
+type ReaderLineReader struct {
+	Reader     *bufio.Reader
+	LineNo     int
+	EOFReached bool
+	Name       string
+	Offset     int64 // number of bytes read till now
+
+	lineOffset   int64
+	decompressor io.Closer
+}
+
+func (rlr *ReaderLineReader) open(input io.Reader) error {
+	var err error
+	rlr.Reader, rlr.decompressor, err = newDecompressingReader(input)
 	if err != nil {
 		return err
 	}
-	flr.UnderlyingFile = file
-	flr.Reader = bufio.NewReader(flr.UnderlyingFile)
-	flr.EOFReached = false
+	rlr.EOFReached = false
 	return nil
 }
 
-// Close the underlying file
-func (flr *FileLineReader) Close() {
-	flr.UnderlyingFile.Close()
+// Close closes the decompressor, closing the input io.Reader is the responsibility of the caller
+func (rlr *ReaderLineReader) Close() {
+	if rlr.decompressor != nil {
+		rlr.decompressor.Close()
+	}
 }
 
 // NextLine returns the nextline along with error
-func (flr *FileLineReader) NextLine() (string, error) {
-	line, err := flr.Reader.ReadString('\n')
+func (rlr *ReaderLineReader) NextLine() (string, error) {
+	line, err := rlr.Reader.ReadString('\n')
+	rlr.lineOffset = rlr.Offset
+	rlr.Offset += int64(len(line))
 	if err != nil {
 		// Couldn't find the new line delimiter, maybe EOF
 		if err == io.EOF && len(line) > 0 {
 			// This is valid case with some data in line, which needs to be processed
-			flr.LineNo++
+			rlr.LineNo++
 			return line, err
 		}
 		// All these other cases are to be treated as this file is no longer valid to be
 		// read
-		flr.EOFReached = true
+		rlr.EOFReached = true
 		return "", err
 	}
-	flr.LineNo++
+	rlr.LineNo++
 	return line[:len(line)-1], err
 }
 
 // GetCurrentLineNumber returns numbers of lines read till now
-func (flr *FileLineReader) GetCurrentLineNumber() int {
-	return flr.LineNo
+func (rlr *ReaderLineReader) GetCurrentLineNumber() int {
+	return rlr.LineNo
 }
 
 // Finished returns true if EOF Reached
-func (flr *FileLineReader) Finished() bool {
-	return flr.EOFReached
+func (rlr *ReaderLineReader) Finished() bool {
+	return rlr.EOFReached
+}
+
+// SourceName returns the name of the source
+func (rlr *ReaderLineReader) SourceName() string {
+	return rlr.Name
+}
+
+// LineOffset returns the byte offset of the line last returned by NextLine
+func (rlr *ReaderLineReader) LineOffset() int64 {
+	return rlr.lineOffset
+}
+
+// NewReaderLineReader returns an object ReaderLineReader, name is used as the source of the lines
+// If the input cannot be decompressed, it returns nil, err
+func NewReaderLineReader(input io.Reader, name string) (*ReaderLineReader, error) {
+	rlr := &ReaderLineReader{Name: name}
+	err := rlr.open(input)
+	if err != nil {
+		return nil, err
+	}
+	return rlr, nil
+}
+
+// FileLineReader implements a LineReader interface for Files
+// gzip, bzip2, xz and zstd compressed files are decompressed transparently
+type FileLineReader struct {
+	ReaderLineReader
+	UnderlyingFile filesystem.File
+}
+
+func (flr *FileLineReader) open(filepath string) error {
+	file, err := filesystem.Open(filepath)
+	if err != nil {
+		return err
+	}
+	flr.UnderlyingFile = file
+	flr.Name = filepath
+	if err = flr.ReaderLineReader.open(file); err != nil {
+		file.Close()
+		return err
+	}
+	return nil
+}
+
+// newDecompressingReader sniffs the magic bytes at the start of the input and wraps it with the matching
+// decompressor. Input which is not compressed is returned as it is. The returned io.Closer is nil when the input is
+// not compressed.
+func newDecompressingReader(input io.Reader) (*bufio.Reader, io.Closer, error) {
+	raw := bufio.NewReader(input)
+	// Peek returns an error along with the available bytes when the input is shorter than the longest magic, such
+	// inputs are either plain text or they will fail while decompressing
+	magic, _ := raw.Peek(len(xzMagic))
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gzReader, err := gzip.NewReader(raw)
+		if err != nil {
+			return nil, nil, err
+		}
+		return bufio.NewReader(gzReader), gzReader, nil
+
+	case bytes.HasPrefix(magic, bzip2Magic) && len(magic) > len(bzip2Magic) && '1' <= magic[3] && magic[3] <= '9':
+		bzip2Reader := ioutil.NopCloser(bzip2.NewReader(raw))
+		return bufio.NewReader(bzip2Reader), bzip2Reader, nil
+
+	case bytes.HasPrefix(magic, xzMagic):
+		xzReader, err := xz.NewReader(raw)
+		if err != nil {
+			return nil, nil, err
+		}
+		return bufio.NewReader(xzReader), ioutil.NopCloser(xzReader), nil
+
+	case bytes.HasPrefix(magic, zstdMagic):
+		zstdReader, err := zstd.NewReader(raw)
+		if err != nil {
+			return nil, nil, err
+		}
+		decompressor := zstdReader.IOReadCloser()
+		return bufio.NewReader(decompressor), decompressor, nil
+	}
+	return raw, nil, nil
+}
+
+// Close the underlying file
+func (flr *FileLineReader) Close() {
+	flr.ReaderLineReader.Close()
+	flr.UnderlyingFile.Close()
 }
 
 // NewFileLineReader returns an object FileLineReader
@@ -80,10 +204,15 @@ func NewFileLineReader(filename string) (*FileLineReader, error) {
 }
 
 // MultiSourceLineReader contains multiple sources of type Interface LineReader
-// and returns lines in lexicographically sorted manner from among the sources
+// and returns lines in sorted manner from among the sources. Lines are compared lexicographically unless LessFunc
+// is provided.
 type MultiSourceLineReader struct {
 	Sources     []LineReader
 	CurrentLine []string
+	CurrentInfo []LineInfo
+	LessFunc    func(line1, line2 string) bool
+
+	lastInfo LineInfo
 }
 
 // AddSources adds to the list of sources
@@ -92,9 +221,22 @@ func (mslr *MultiSourceLineReader) AddSources(linereaders ...LineReader) {
 		mslr.Sources = append(mslr.Sources, linereaders[index])
 		currentLine, _ := linereaders[index].NextLine()
 		mslr.CurrentLine = append(mslr.CurrentLine, currentLine)
+		mslr.CurrentInfo = append(mslr.CurrentInfo, currentLineInfo(linereaders[index]))
 	}
 }
 
+// currentLineInfo returns the LineInfo of the line last read from the LineReader
+func currentLineInfo(lr LineReader) LineInfo {
+	info := LineInfo{LineNo: lr.GetCurrentLineNumber()}
+	if named, ok := lr.(namedLineReader); ok {
+		info.Source = named.SourceName()
+	}
+	if offsetReader, ok := lr.(offsetLineReader); ok {
+		info.Offset = offsetReader.LineOffset()
+	}
+	return info
+}
+
 // NextLine returns NextLine and a status code
 // status code = 0, Success
 // status code = 1, Failure
@@ -104,7 +246,7 @@ func (mslr *MultiSourceLineReader) NextLine() (nextLine string, err int) {
 		if mslr.Sources[i].Finished() {
 			continue
 		}
-		if (minIndex == -1) || (mslr.CurrentLine[i] < nextLine) {
+		if (minIndex == -1) || mslr.less(mslr.CurrentLine[i], nextLine) {
 			nextLine = mslr.CurrentLine[i]
 			minIndex = i
 		}
@@ -112,10 +254,24 @@ func (mslr *MultiSourceLineReader) NextLine() (nextLine string, err int) {
 	if minIndex == -1 {
 		return "", -1
 	}
+	mslr.lastInfo = mslr.CurrentInfo[minIndex]
 	mslr.CurrentLine[minIndex], _ = mslr.Sources[minIndex].NextLine()
+	mslr.CurrentInfo[minIndex] = currentLineInfo(mslr.Sources[minIndex])
 	return nextLine, 0
 }
 
+// LastLineInfo returns the LineInfo of the line last returned by NextLine
+func (mslr *MultiSourceLineReader) LastLineInfo() LineInfo {
+	return mslr.lastInfo
+}
+
+func (mslr *MultiSourceLineReader) less(line1, line2 string) bool {
+	if mslr.LessFunc != nil {
+		return mslr.LessFunc(line1, line2)
+	}
+	return line1 < line2
+}
+
 // NewMultiSourceLineReader create a new MultiLineSourceReader
 func NewMultiSourceLineReader() *MultiSourceLineReader {
 	return &MultiSourceLineReader{}
@@ -0,0 +1,97 @@
+package logparser
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+)
+
+const (
+	// gSeekMinRange is the size of the range of the file below which the lines are read sequentially
+	gSeekMinRange = 64 * 1024
+	// gSeekProbeLimit is the number of bytes read at a probed offset to find a line which can be compared, e.g. a line
+	// with a timestamp
+	gSeekProbeLimit = 64 * 1024
+)
+
+// seekToFirstLine moves the reader near the first line for which isAtOrAfter returns true, the lines of the file must be
+// in order. isAtOrAfter returns false as the second value if the line cannot be compared, e.g. a continuation line
+// without a timestamp. The reader is positioned on a line before the first such line, so the lines before it still
+// have to be skipped by the caller. Line numbers and offsets of the lines are kept correct. Compressed files cannot be
+// seeked and they are read from the beginning.
+func (flr *FileLineReader) seekToFirstLine(isAtOrAfter func(line string) (bool, bool)) error {
+	if flr.decompressor != nil || flr.LineNo > 0 {
+		return nil
+	}
+	size, err := flr.UnderlyingFile.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	// lo is always the start of a line which is before the first line or the start of the file
+	lo, hi := int64(0), size
+	for hi-lo > gSeekMinRange {
+		mid := lo + (hi-lo)/2
+		lineStart, atOrAfter, found := flr.probe(mid, size, isAtOrAfter)
+		if !found || atOrAfter {
+			hi = mid
+		} else {
+			lo = lineStart
+		}
+	}
+
+	lineNo, err := flr.countLines(lo)
+	if err != nil {
+		return err
+	}
+	if _, err = flr.UnderlyingFile.Seek(lo, io.SeekStart); err != nil {
+		return err
+	}
+	flr.Reader = bufio.NewReader(flr.UnderlyingFile)
+	flr.EOFReached = false
+	flr.LineNo = lineNo
+	flr.Offset = lo
+	return nil
+}
+
+// probe returns the first comparable line which starts after the offset
+func (flr *FileLineReader) probe(offset, size int64, isAtOrAfter func(line string) (bool, bool)) (int64, bool, bool) {
+	// reading from the previous byte finds the line starting at the offset as well
+	start := offset - 1
+	reader := bufio.NewReader(io.NewSectionReader(flr.UnderlyingFile, start, size-start))
+	skipped, err := reader.ReadString('\n')
+	if err != nil {
+		return 0, false, false
+	}
+	lineStart := start + int64(len(skipped))
+	for lineStart-offset < gSeekProbeLimit {
+		line, err := reader.ReadString('\n')
+		if len(line) == 0 && err != nil {
+			return 0, false, false
+		}
+		if atOrAfter, ok := isAtOrAfter(strings.TrimSuffix(line, "\n")); ok {
+			return lineStart, atOrAfter, true
+		}
+		lineStart += int64(len(line))
+	}
+	return 0, false, false
+}
+
+// countLines returns the number of lines before the offset, offset is the start of a line
+func (flr *FileLineReader) countLines(offset int64) (int, error) {
+	count := 0
+	buf := make([]byte, 64*1024)
+	for pos := int64(0); pos < offset; {
+		chunk := buf
+		if remaining := offset - pos; remaining < int64(len(chunk)) {
+			chunk = chunk[:remaining]
+		}
+		n, err := flr.UnderlyingFile.ReadAt(chunk, pos)
+		count += bytes.Count(chunk[:n], []byte{'\n'})
+		pos += int64(n)
+		if err != nil && pos < offset {
+			return 0, err
+		}
+	}
+	return count, nil
+}
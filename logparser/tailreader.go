@@ -0,0 +1,175 @@
+package logparser
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	defaultPollInterval = 200 * time.Millisecond
+)
+
+// TailLineReader implements a LineReader interface which keeps on reading a file after EOF, like `tail -F`.
+// Truncation and logrotate style renames of the file are detected and the new file is read from its beginning.
+// NextLine blocks until a complete line is available or the reader is stopped.
+type TailLineReader struct {
+	Filename     string
+	PollInterval time.Duration
+	LineNo       int // line number of the last line in the file it is read from, it restarts when the file is reopened
+
+	file     *os.File
+	fileInfo os.FileInfo
+	reader   *bufio.Reader
+	offset   int64
+	partial  string
+	stop     <-chan struct{}
+	finished bool
+	reopened bool // LineNo is reset with the next line of the reopened file
+
+	// partialOffset is the offset of the partial line, it is the offset of the line once it is complete
+	partialOffset int64
+	lineOffset    int64
+}
+
+func (tlr *TailLineReader) open() error {
+	file, err := os.Open(tlr.Filename)
+	if err != nil {
+		return err
+	}
+	fileInfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if tlr.file != nil {
+		tlr.file.Close()
+	}
+	tlr.file = file
+	tlr.fileInfo = fileInfo
+	tlr.reader = bufio.NewReader(file)
+	tlr.offset = 0
+	tlr.partial = ""
+	tlr.reopened = true
+	return nil
+}
+
+// countLine updates LineNo for a line of the current file
+func (tlr *TailLineReader) countLine() {
+	if tlr.reopened {
+		tlr.LineNo = 0
+		tlr.reopened = false
+	}
+	tlr.LineNo++
+}
+
+// Close the underlying file
+func (tlr *TailLineReader) Close() {
+	if tlr.file != nil {
+		tlr.file.Close()
+	}
+}
+
+// NextLine returns the nextline along with error. It waits for the file to grow when EOF is reached and returns io.EOF
+// only after the reader is stopped.
+func (tlr *TailLineReader) NextLine() (string, error) {
+	for {
+		chunk, err := tlr.reader.ReadString('\n')
+		if len(tlr.partial) == 0 {
+			tlr.partialOffset = tlr.offset
+		}
+		tlr.offset += int64(len(chunk))
+		tlr.partial += chunk
+		if err == nil {
+			line := tlr.partial[:len(tlr.partial)-1]
+			tlr.partial = ""
+			tlr.lineOffset = tlr.partialOffset
+			tlr.countLine()
+			return line, nil
+		}
+		if err != io.EOF {
+			tlr.finished = true
+			return "", err
+		}
+
+		if rotated, partial := tlr.checkRotation(); rotated && len(partial) > 0 {
+			// the last line of the rotated file is complete as nothing will be written to it anymore, it is counted in
+			// the rotated file
+			tlr.lineOffset = tlr.partialOffset
+			tlr.LineNo++
+			return partial, nil
+		}
+
+		select {
+		case <-tlr.stop:
+			tlr.finished = true
+			if len(tlr.partial) > 0 {
+				line := tlr.partial
+				tlr.partial = ""
+				tlr.lineOffset = tlr.partialOffset
+				tlr.countLine()
+				return line, io.EOF
+			}
+			return "", io.EOF
+		case <-time.After(tlr.PollInterval):
+		}
+	}
+}
+
+// checkRotation reopens the file if it has been renamed or truncated. It returns true if the file is reopened along with
+// the incomplete line left in the previous file.
+func (tlr *TailLineReader) checkRotation() (bool, string) {
+	fileInfo, err := os.Stat(tlr.Filename)
+	if err != nil {
+		// file is renamed but the new file is not created yet
+		return false, ""
+	}
+	if os.SameFile(fileInfo, tlr.fileInfo) && fileInfo.Size() >= tlr.offset {
+		return false, ""
+	}
+	partial := tlr.partial
+	if os.SameFile(fileInfo, tlr.fileInfo) {
+		// data of the truncated file is no longer valid
+		partial = ""
+	}
+	if err := tlr.open(); err != nil {
+		return false, ""
+	}
+	return true, partial
+}
+
+// GetCurrentLineNumber returns the line number of the last line in the file it is read from, lines of a file reopened
+// after rotation or truncation are counted from 1 like their offsets start from 0
+func (tlr *TailLineReader) GetCurrentLineNumber() int {
+	return tlr.LineNo
+}
+
+// LineOffset returns the byte offset of the line last returned by NextLine in the file it is read from
+func (tlr *TailLineReader) LineOffset() int64 {
+	return tlr.lineOffset
+}
+
+// SourceName returns the name of the followed file
+func (tlr *TailLineReader) SourceName() string {
+	return tlr.Filename
+}
+
+// Finished returns true if the reader has been stopped
+func (tlr *TailLineReader) Finished() bool {
+	return tlr.finished
+}
+
+// NewTailLineReader returns an object TailLineReader which follows the file until the stop channel is closed
+// If file opening fails, it returns nil, err
+func NewTailLineReader(filename string, stop <-chan struct{}) (*TailLineReader, error) {
+	tlr := &TailLineReader{
+		Filename:     filename,
+		PollInterval: defaultPollInterval,
+		stop:         stop,
+	}
+	if err := tlr.open(); err != nil {
+		return nil, err
+	}
+	return tlr, nil
+}
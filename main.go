@@ -3,6 +3,9 @@ package main
 import (
 	"errors"
 	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
 	"tocsv/filterlogs"
 	"tocsv/tocsvgo"
 
@@ -11,6 +14,11 @@ import (
 
 var appname = "tocsv"
 
+func isStdinPiped() bool {
+	stat, err := os.Stdin.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice == 0
+}
+
 func main() {
 	inputFiles := []string{}
 	configFile := ""
@@ -19,6 +27,13 @@ func main() {
 	printLogLines := false
 	interactiveMode := false
 	dumpConfig := false
+	followMode := false
+	format := ""
+	outputFile := ""
+	since := ""
+	until := ""
+	where := ""
+	whereKeepOtherApps := false
 
 	rootCmd := &cobra.Command{
 		Use: appname,
@@ -35,13 +50,14 @@ func main() {
 			}
 		},
 		Args: func(cmd *cobra.Command, args []string) error {
-			if len(inputFiles) != 0 {
-				return nil
-			}
-			if len(args) == 0 {
-				return errors.New("please provide log file")
+			if len(inputFiles) == 0 && len(args) == 0 {
+				if !isStdinPiped() {
+					return errors.New("please provide log file")
+				}
+				// read loglines from stdin, e.g. `grep foo big.log | tocsv`
+				args = []string{filterlogs.StdinInput}
 			}
-			inputFiles = args[:]
+			inputFiles = append(inputFiles, args...)
 			return nil
 		},
 	}
@@ -51,11 +67,17 @@ func main() {
 	// rootCmd.Flags().StringArrayVarP(&configFiles, "config", "c", []string{defaultConfigFile}, "input config yamls for tocsv app")
 	rootCmd.Flags().StringVarP(&configFile, "config", "c", defaultConfigFile, "input config yamls for tocsv app")
 	rootCmd.Flags().StringArrayVarP(&anchorFiles, "anchor", "a", []string{}, "input anchor config yamls files")
-	rootCmd.Flags().StringArrayVarP(&inputFiles, "files", "f", []string{}, "input logfiles for tocsv app")
+	rootCmd.Flags().StringArrayVarP(&inputFiles, "files", "f", []string{}, "input logfiles for tocsv app, use - to read from stdin")
 	rootCmd.Flags().BoolVarP(&printOnStdout, "print", "p", false, "print the output on stdout")
-	// TODO, printLogLines is a part of tocsv not filterlogs
-	rootCmd.Flags().BoolVarP(&printLogLines, "loglines", "l", false, "log actual loglines with csv")
+	rootCmd.Flags().BoolVarP(&printLogLines, "loglines", "l", false, "add __file__, __lineno__, __offset__ and __logline__ columns in the output")
 	rootCmd.Flags().BoolVarP(&interactiveMode, "interactive", "i", false, "interactive mode on")
+	rootCmd.Flags().BoolVarP(&followMode, "follow", "F", false, "follow the logfiles as they grow, stop with Ctrl-C")
+	rootCmd.Flags().StringVar(&format, "format", "", "output format, csv, jsonl, parquet, sqlite or xlsx (default is Format in config or csv)")
+	rootCmd.Flags().StringVar(&outputFile, "out", "", "output file of the sqlite and xlsx formats")
+	rootCmd.Flags().StringVar(&since, "since", "", "keep the records at or after this time, e.g. '2020-12-31 09:15:00' or '09:15'")
+	rootCmd.Flags().StringVar(&until, "until", "", "keep the records before this time, e.g. '2020-12-31 15:30:00' or '15:30'")
+	rootCmd.Flags().StringVar(&where, "where", "", "keep the records for which the expression is true, e.g. \"side == 'BUY' && quantity > 500\", records of the apps without its elements are dropped")
+	rootCmd.Flags().BoolVar(&whereKeepOtherApps, "where-keep-other-apps", false, "keep the records of the apps which do not have all the elements used in --where")
 	// TODO, dump config
 	rootCmd.Flags().BoolVarP(&dumpConfig, "dump-config", "d", false, "dump sample config")
 
@@ -68,14 +90,29 @@ func main() {
 		return
 	}
 
-	if len(inputFiles) > 1 {
-		fmt.Println("ERROR, more than one logfile is not supported currently: ", inputFiles)
-		return
-	}
-
 	tocsv := tocsvgo.NewTocsv(inputFiles, configFile, anchorFiles, printOnStdout, interactiveMode)
 	if tocsv != nil {
+		if len(format) > 0 && !tocsv.SetFormat(format) {
+			return
+		}
+		if len(outputFile) > 0 {
+			tocsv.SetOutputFile(outputFile)
+		}
+		if printLogLines {
+			tocsv.SetPrintLogLines(true)
+		}
+		tocsv.SetTimeRange(since, until)
+		tocsv.SetWhere(where)
+		tocsv.SetWhereKeepOtherApps(whereKeepOtherApps)
+		tocsv.SetFollowMode(followMode)
+		// records found till now are written to the output when interrupted
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-signals
+			tocsv.Stop()
+		}()
 		tocsv.Run()
+		tocsv.DisplayFetchedCsvs()
 	}
-	tocsv.DisplayFetchedCsvs()
 }
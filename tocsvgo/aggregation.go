@@ -0,0 +1,386 @@
+package tocsvgo
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"tocsv/filterlogs"
+)
+
+// Functions of the aggregations, percentiles are given as p followed by the percentile, e.g. p99 or p99.9
+const (
+	gAggregateCount = "count"
+	gAggregateSum   = "sum"
+	gAggregateAvg   = "avg"
+	gAggregateMin   = "min"
+	gAggregateMax   = "max"
+)
+
+var gAggregateRegex = regexp.MustCompile(`^\s*(\w+(?:\.\d+)?)\(\s*([^()]*?)\s*\)\s*$`)
+var gPercentileRegex = regexp.MustCompile(`^p(\d+(?:\.\d+)?)$`)
+
+// AggregationConfig stores the config of a summary table of the records of an app, it is written as an additional
+// output named Name. Aggregates are updated with each record, only the values of the percentiles are kept in memory.
+type AggregationConfig struct {
+	// Name of the output of the summary table, it is used as the AppName in OutputFileTemplate
+	Name string `yaml:"Name"`
+	// App is the AppName whose records are aggregated
+	App string `yaml:"App"`
+	// GroupBy are the columns, element key or ColumnName, whose values make a row of the summary table, e.g.
+	// [securityId, side]. All the records are aggregated in a single row if it is empty.
+	GroupBy []string `yaml:"GroupBy"`
+	// Aggregates are count(), count(column), sum(column), avg(column), min(column), max(column) and percentiles like
+	// p99(column). N/A values are ignored. Columns are named as the function followed by the column, e.g. sum_quantity.
+	Aggregates []string `yaml:"Aggregates"`
+}
+
+// aggregate is a parsed function of Aggregates
+type aggregate struct {
+	function   string
+	column     string
+	percentile float64
+}
+
+func parseAggregate(text string) (*aggregate, error) {
+	match := gAggregateRegex.FindStringSubmatch(text)
+	if match == nil {
+		return nil, fmt.Errorf("cannot parse aggregate %q, e.g. sum(quantity)", text)
+	}
+	agg := &aggregate{function: match[1], column: match[2]}
+	if percentile := gPercentileRegex.FindStringSubmatch(agg.function); percentile != nil {
+		agg.percentile, _ = strconv.ParseFloat(percentile[1], 64)
+		if agg.percentile <= 0 || agg.percentile > 100 {
+			return nil, fmt.Errorf("percentile of aggregate %q should be in (0, 100]", text)
+		}
+	} else if agg.function != gAggregateCount && agg.function != gAggregateSum && agg.function != gAggregateAvg &&
+		agg.function != gAggregateMin && agg.function != gAggregateMax {
+		return nil, fmt.Errorf("unknown function of aggregate %q, supported functions are count, sum, avg, min, max and percentiles like p99", text)
+	}
+	if len(agg.column) == 0 && agg.function != gAggregateCount {
+		return nil, fmt.Errorf("please provide the column of aggregate %q", text)
+	}
+	return agg, nil
+}
+
+// name returns the column name of the aggregate in the summary table
+func (agg *aggregate) name() string {
+	if len(agg.column) == 0 {
+		return agg.function
+	}
+	return agg.function + "_" + agg.column
+}
+
+// verifyAggregations verifies the Aggregations config, apps and columns of the aggregations are verified by
+// newAggregators
+func (config *TocsvConfig) verifyAggregations() error {
+	names := map[string]bool{}
+	for _, join := range config.Joins {
+		names[join.Name] = true
+	}
+	for _, aggregation := range config.Aggregations {
+		if len(aggregation.Name) == 0 || len(aggregation.App) == 0 || len(aggregation.Aggregates) == 0 {
+			return fmt.Errorf("please provide Name, App and Aggregates of the aggregation, e.g. {Name: OrdersSummary, App: Orders, GroupBy: [side], Aggregates: ['count()']}")
+		}
+		if names[aggregation.Name] {
+			return fmt.Errorf("Name of the aggregation %s is already used by another aggregation or join", aggregation.Name)
+		}
+		names[aggregation.Name] = true
+		for _, text := range aggregation.Aggregates {
+			if _, err := parseAggregate(text); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// newAggregators returns the aggregator of each aggregation, key is the Name of the aggregation. headers are the
+// columns of each app, an error is returned if the app or a column of an aggregation is not found.
+func (config *TocsvConfig) newAggregators(headers map[string][]*filterlogs.MetaInfoType) (map[string]*aggregator, error) {
+	aggregators := map[string]*aggregator{}
+	for _, aggregation := range config.Aggregations {
+		header, exists := headers[aggregation.App]
+		if !exists {
+			return nil, fmt.Errorf("app %s of the aggregation %s is not found", aggregation.App, aggregation.Name)
+		}
+		agg, err := newAggregator(aggregation, header)
+		if err != nil {
+			return nil, err
+		}
+		aggregators[aggregation.Name] = agg
+	}
+	return aggregators, nil
+}
+
+// aggregator computes the summary table of an aggregation from the records of its app
+type aggregator struct {
+	config     *AggregationConfig
+	header     []*filterlogs.MetaInfoType
+	groupIndex []int
+	aggregates []*aggregate
+	index      []int // index of the column of each aggregate in the header, -1 for count()
+	groups     map[string]*aggregateGroup
+	groupKeys  []string // keys of the groups in the order of their first record
+}
+
+// aggregateGroup is a row of the summary table
+type aggregateGroup struct {
+	values []*filterlogs.FilteredData // values of the GroupBy columns
+	states []*aggregateState
+}
+
+// aggregateState is the state of an aggregate of a group
+type aggregateState struct {
+	count    int64
+	sum      float64
+	min, max *filterlogs.FilteredData
+	values   []float64 // used only by the percentiles
+
+	// intSum is the sum of the ints and durations, they are added as int64 to avoid the rounding of large numbers.
+	// intCount is the number of values added to it.
+	intSum, intCount int64
+}
+
+func newAggregator(config *AggregationConfig, header []*filterlogs.MetaInfoType) (*aggregator, error) {
+	agg := &aggregator{config: config, header: header, groups: map[string]*aggregateGroup{}}
+	for _, column := range config.GroupBy {
+		i := columnIndex(header, column)
+		if i < 0 {
+			return nil, fmt.Errorf("GroupBy column %s of app %s is not found for the aggregation %s", column, config.App, config.Name)
+		}
+		agg.groupIndex = append(agg.groupIndex, i)
+	}
+	for _, text := range config.Aggregates {
+		a, err := parseAggregate(text)
+		if err != nil {
+			return nil, err
+		}
+		i := -1
+		if len(a.column) > 0 {
+			if i = columnIndex(header, a.column); i < 0 {
+				return nil, fmt.Errorf("column %s of app %s is not found for the aggregation %s", a.column, config.App, config.Name)
+			}
+			isTimestamp := header[i].Type == filterlogs.TypeTimestamp
+			if isTimestamp && a.function != gAggregateCount && a.function != gAggregateMin && a.function != gAggregateMax {
+				return nil, fmt.Errorf("only count, min and max can be used with the timestamp column %s in the aggregation %s", a.column, config.Name)
+			}
+		}
+		agg.aggregates = append(agg.aggregates, a)
+		agg.index = append(agg.index, i)
+	}
+	return agg, nil
+}
+
+// numericValue returns the value used by sum, avg and the percentiles, durations are in nanoseconds
+func numericValue(filteredData *filterlogs.FilteredData) (float64, bool) {
+	switch value := filteredData.Value.(type) {
+	case int64:
+		return float64(value), true
+	case float64:
+		return value, true
+	case *big.Rat:
+		f, _ := value.Float64()
+		return f, true
+	case time.Duration:
+		return float64(value), true
+	case bool, time.Time:
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(filteredData.Text, 64)
+	return f, err == nil && !math.IsInf(f, 0) && !math.IsNaN(f)
+}
+
+// lessAggregateValue compares the values for min and max, typed values are compared by their type and the other
+// values are compared as numbers if both can be parsed as numbers
+func lessAggregateValue(a, b *filterlogs.FilteredData) bool {
+	if ta, ok := a.Value.(time.Time); ok {
+		if tb, ok := b.Value.(time.Time); ok {
+			return ta.Before(tb)
+		}
+	}
+	fa, okA := numericValue(a)
+	fb, okB := numericValue(b)
+	if okA && okB {
+		return fa < fb
+	}
+	return a.Text < b.Text
+}
+
+// add updates the group of the record with its values, record contains the values of the header. N/A and N/F values
+// are ignored by all the aggregates except count().
+func (agg *aggregator) add(record []*filterlogs.FilteredData) {
+	keyValues := make([]string, len(agg.groupIndex))
+	for i, index := range agg.groupIndex {
+		if record[index] == nil {
+			keyValues[i] = "N/A"
+		} else {
+			keyValues[i] = record[index].Text
+		}
+	}
+	key := strings.Join(keyValues, "\x00")
+	group, exists := agg.groups[key]
+	if !exists {
+		group = &aggregateGroup{}
+		for _, index := range agg.groupIndex {
+			group.values = append(group.values, record[index])
+		}
+		for range agg.aggregates {
+			group.states = append(group.states, &aggregateState{})
+		}
+		agg.groups[key] = group
+		agg.groupKeys = append(agg.groupKeys, key)
+	}
+
+	for i, a := range agg.aggregates {
+		state := group.states[i]
+		if agg.index[i] < 0 {
+			state.count++
+			continue
+		}
+		filteredData := record[agg.index[i]]
+		if filteredData == nil || filteredData.Text == filterlogs.NotFound {
+			continue
+		}
+		switch {
+		case a.function == gAggregateMin || a.function == gAggregateMax:
+			if state.min == nil || lessAggregateValue(filteredData, state.min) {
+				state.min = filteredData
+			}
+			if state.max == nil || lessAggregateValue(state.max, filteredData) {
+				state.max = filteredData
+			}
+			state.count++
+		case a.function == gAggregateCount:
+			state.count++
+		default:
+			value, ok := numericValue(filteredData)
+			if !ok {
+				continue
+			}
+			state.count++
+			state.sum += value
+			switch v := filteredData.Value.(type) {
+			case int64:
+				state.intSum += v
+				state.intCount++
+			case time.Duration:
+				state.intSum += int64(v)
+				state.intCount++
+			}
+			if a.percentile > 0 {
+				state.values = append(state.values, value)
+			}
+		}
+	}
+}
+
+// columns returns the columns of the summary table, the GroupBy columns followed by the aggregates
+func (agg *aggregator) columns() []*filterlogs.MetaInfoType {
+	columns := []*filterlogs.MetaInfoType{}
+	for _, index := range agg.groupIndex {
+		columns = append(columns, agg.header[index])
+	}
+	for i, a := range agg.aggregates {
+		column := &filterlogs.MetaInfoType{ElementKey: a.name(), Type: filterlogs.TypeFloat}
+		switch {
+		case a.function == gAggregateCount:
+			column.Type = filterlogs.TypeInt
+		case agg.header[agg.index[i]].Type == filterlogs.TypeDuration:
+			column.Type = filterlogs.TypeDuration
+		case a.function == gAggregateMin || a.function == gAggregateMax:
+			column.Type = agg.header[agg.index[i]].Type
+			column.Layout = agg.header[agg.index[i]].Layout
+		case a.function == gAggregateSum && agg.header[agg.index[i]].Type == filterlogs.TypeInt:
+			column.Type = filterlogs.TypeInt
+		}
+		columns = append(columns, column)
+	}
+	return columns
+}
+
+// records returns the rows of the summary table in the order of the first record of each group
+func (agg *aggregator) records(columns []*filterlogs.MetaInfoType) [][]*filterlogs.FilteredData {
+	records := [][]*filterlogs.FilteredData{}
+	for _, key := range agg.groupKeys {
+		group := agg.groups[key]
+		record := append([]*filterlogs.FilteredData{}, group.values...)
+		for i, a := range agg.aggregates {
+			record = append(record, group.states[i].result(a, columns[len(agg.groupIndex)+i]))
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// result returns the value of the aggregate, nil (N/A) is returned if there are no values
+func (state *aggregateState) result(a *aggregate, column *filterlogs.MetaInfoType) *filterlogs.FilteredData {
+	if a.function == gAggregateCount {
+		return &filterlogs.FilteredData{Text: strconv.FormatInt(state.count, 10), Value: state.count}
+	}
+	if state.count == 0 {
+		return nil
+	}
+	switch a.function {
+	case gAggregateMin:
+		return state.min
+	case gAggregateMax:
+		return state.max
+	}
+	value := state.sum
+	if a.function == gAggregateAvg {
+		value = state.sum / float64(state.count)
+	} else if a.percentile > 0 {
+		// nearest rank percentile
+		sort.Float64s(state.values)
+		rank := int(math.Ceil(a.percentile / 100 * float64(len(state.values))))
+		if rank < 1 {
+			rank = 1
+		}
+		value = state.values[rank-1]
+	}
+	if a.function == gAggregateSum && state.intCount == state.count {
+		switch column.Type {
+		case filterlogs.TypeInt:
+			return &filterlogs.FilteredData{Text: strconv.FormatInt(state.intSum, 10), Value: state.intSum}
+		case filterlogs.TypeDuration:
+			duration := time.Duration(state.intSum)
+			return &filterlogs.FilteredData{Text: duration.String(), Value: duration}
+		}
+	}
+	switch column.Type {
+	case filterlogs.TypeInt:
+		return &filterlogs.FilteredData{Text: strconv.FormatInt(int64(value), 10), Value: int64(value)}
+	case filterlogs.TypeDuration:
+		duration := time.Duration(value)
+		return &filterlogs.FilteredData{Text: duration.String(), Value: duration}
+	}
+	return &filterlogs.FilteredData{Text: strconv.FormatFloat(value, 'f', -1, 64), Value: value}
+}
+
+// aggregateRecord adds the record of the app to its aggregations, record contains the values of the header of the
+// app
+func (a *Tocsv) aggregateRecord(appName string, record []*filterlogs.FilteredData) {
+	for _, config := range a.Config.Aggregations {
+		if config.App == appName {
+			a.aggregators[config.Name].add(record)
+		}
+	}
+}
+
+// writeAggregations writes the summary table of each aggregation after reading all the input
+func (a *Tocsv) writeAggregations() {
+	for _, config := range a.Config.Aggregations {
+		if _, exists := a.AppData[config.App]; !exists {
+			fmt.Println("WARN, aggregation", config.Name, "is not written as there are no records of", config.App)
+			continue
+		}
+		agg := a.aggregators[config.Name]
+		columns := agg.columns()
+		a.writeTable(config.Name, columns, agg.records(columns))
+	}
+}
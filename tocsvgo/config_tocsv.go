@@ -15,7 +15,58 @@ import (
 type TocsvConfig struct {
 	AnchorFiles      []string `yaml:"AnchorFiles"`
 	PrintTagInOutput bool     `yaml:"PrintTagInOutput"`
-	LogDirectory     string   `yaml:"LogDirectory"`
+	// PrintSourceInOutput adds the input file and the line number of each record in the output
+	PrintSourceInOutput bool `yaml:"PrintSourceInOutput"`
+	// PrintLogLinesInOutput adds the input file, the line number, the byte offset and the logline of each record in the
+	// output so that each record can be traced back to its logline
+	PrintLogLinesInOutput bool   `yaml:"PrintLogLinesInOutput"`
+	LogDirectory          string `yaml:"LogDirectory"`
+	// OutputFileTemplate is the name of the output file of each app, relative to LogDirectory. Placeholders are {app},
+	// {tag}, {input} (basename of the input file), {first} and {last} (timestamp of the first and the last record),
+	// {run} (time of the run) and {ext} (Format). Time placeholders take an optional go layout, e.g. {run:2006-01-02}.
+	// A separate file is written for each tag and each input file if {tag} and {input} are used. Default is
+	// {app}.{run}.{ext} where {run} is YYYYMMDD.
+	OutputFileTemplate string `yaml:"OutputFileTemplate"`
+	// OnOutputFileExists is overwrite (default), append or unique, unique adds a numeric suffix to the file name. It is
+	// not used by the formats which write all the apps in a single file.
+	OnOutputFileExists string `yaml:"OnOutputFileExists"`
+	// OnHeaderMismatch is used while appending to an existing csv file whose header differs from the output columns of
+	// the app. It is strict (default) which refuses to append or reconcile which adds the new columns at the end of the
+	// existing header, the columns missing in the app are N/A in the appended rows.
+	OnHeaderMismatch string `yaml:"OnHeaderMismatch"`
+	// Format of the output files, csv (default), jsonl, parquet, sqlite or xlsx
+	Format string `yaml:"Format"`
+	// OutputFile is used by the formats which write all the apps in a single file (sqlite and xlsx), default is
+	// <LogDirectory>/tocsv.<YYYYMMDD>.<Format>
+	OutputFile string         `yaml:"OutputFile"`
+	Parquet    *ParquetConfig `yaml:"Parquet"`
+	Sqlite     *SqliteConfig  `yaml:"Sqlite"`
+	// Joins correlate the records of two apps on key columns, each join is written as an additional output
+	Joins []*JoinConfig `yaml:"Joins"`
+	// Aggregations are the summary tables of the records of the apps, each is written as an additional output
+	Aggregations []*AggregationConfig `yaml:"Aggregations"`
+	// Pairs match the records of a start tag with the records of an end tag of an app, e.g. an order sent and its
+	// reply, the pairs and the unmatched starts are written as additional outputs
+	Pairs []*PairConfig `yaml:"Pairs"`
+}
+
+// ParquetConfig stores the options for the parquet output files
+type ParquetConfig struct {
+	// RowGroupSize is the size of a row group in MB, default is 128
+	RowGroupSize int64 `yaml:"RowGroupSize"`
+	// Compression is one of snappy (default), gzip, zstd or uncompressed
+	Compression string `yaml:"Compression"`
+}
+
+// SqliteConfig stores the options for the sqlite output database, each app is stored in a table named AppName
+type SqliteConfig struct {
+	// Mode is append (default) or replace, replace drops the existing tables of the apps
+	Mode string `yaml:"Mode"`
+	// BatchSize is the number of rows inserted in a transaction, default is 10000
+	BatchSize int `yaml:"BatchSize"`
+	// Indexes are created on the table of each app, key is AppName and each index is a list of column names, e.g.
+	// Orders: [[securityId], [securityId, timestamp]]
+	Indexes map[string][][]string `yaml:"Indexes"`
 }
 
 // NewToCsvConfig return an instance of TocsvConfig struct
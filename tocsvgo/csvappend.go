@@ -0,0 +1,117 @@
+package tocsvgo
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/parmaanu/goutils/findutils"
+)
+
+// Policies of OnHeaderMismatch
+const (
+	gOnHeaderMismatchStrict    = "strict"
+	gOnHeaderMismatchReconcile = "reconcile"
+)
+
+var gOnHeaderMismatchPolicies = []string{gOnHeaderMismatchStrict, gOnHeaderMismatchReconcile}
+
+// readCsvHeader returns the header of the csv file
+func readCsvHeader(fname string) ([]string, error) {
+	file, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return csv.NewReader(file).Read()
+}
+
+// reconcileCsvHeader checks the header of the existing csv file against the header of the app. It returns nil if they
+// are the same, otherwise the index of each column of the file in the records of the app. With the reconcile policy
+// the columns which are not present in the file are added at the end of its header and the existing rows have N/A in
+// them.
+func reconcileCsvHeader(fname string, header []string, policy string) ([]int, error) {
+	existingHeader, err := readCsvHeader(fname)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the header of existing file, %s", err)
+	}
+	if reflect.DeepEqual(existingHeader, header) {
+		return nil, nil
+	}
+	if policy != gOnHeaderMismatchReconcile {
+		return nil, fmt.Errorf("header of existing file [%s] does not match the output columns [%s], use "+
+			"OnHeaderMismatch: %s to reconcile them", strings.Join(existingHeader, ","), strings.Join(header, ","),
+			gOnHeaderMismatchReconcile)
+	}
+
+	addedColumns := []string{}
+	for _, name := range header {
+		if !findutils.ContainsString(existingHeader, name) {
+			addedColumns = append(addedColumns, name)
+		}
+	}
+	if len(addedColumns) > 0 {
+		if err = addCsvColumns(fname, addedColumns); err != nil {
+			return nil, fmt.Errorf("unable to add columns %s to existing file, %s", strings.Join(addedColumns, ","), err)
+		}
+		existingHeader = append(existingHeader, addedColumns...)
+	}
+
+	columnIndex := make([]int, len(existingHeader))
+	for i, name := range existingHeader {
+		columnIndex[i] = findutils.IndexOfString(header, name)
+	}
+	return columnIndex, nil
+}
+
+// addCsvColumns rewrites the csv file with the columns added at the end of the header, the rows have N/A in the added
+// columns
+func addCsvColumns(fname string, addedColumns []string) error {
+	file, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	// rows written by older versions may have a different number of fields
+	reader.FieldsPerRecord = -1
+
+	tmpFname := fname + ".tmp"
+	tmpFile, err := os.Create(tmpFname)
+	if err != nil {
+		return err
+	}
+	writer := csv.NewWriter(tmpFile)
+	for isHeader := true; ; isHeader = false {
+		record, err := reader.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			tmpFile.Close()
+			os.Remove(tmpFname)
+			return err
+		}
+		for _, column := range addedColumns {
+			if isHeader {
+				record = append(record, column)
+			} else {
+				record = append(record, "N/A")
+			}
+		}
+		writer.Write(record)
+	}
+	writer.Flush()
+	err = writer.Error()
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpFname)
+		return err
+	}
+	return os.Rename(tmpFname, fname)
+}
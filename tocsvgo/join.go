@@ -0,0 +1,282 @@
+package tocsvgo
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"tocsv/filterlogs"
+
+	"github.com/parmaanu/goutils/errorutils"
+	"github.com/parmaanu/goutils/findutils"
+)
+
+// Modes of a join
+const (
+	gJoinInner = "inner"
+	gJoinLeft  = "left"
+	gJoinAsof  = "asof"
+)
+
+var gJoinModes = []string{gJoinInner, gJoinLeft, gJoinAsof}
+
+// JoinConfig stores the config of a join of the records of two apps, the joined records are written in an output
+// named Name along with the outputs of the apps. Records of the joined apps are kept in memory till the end of the
+// input.
+type JoinConfig struct {
+	// Name of the output of the join, it is used as the AppName in OutputFileTemplate
+	Name string `yaml:"Name"`
+	// Left and Right are the AppNames, each record of the Left app is written with the matching records of the Right
+	// app, e.g. Left: Executions, Right: Orders to see each fill next to its order
+	Left  string `yaml:"Left"`
+	Right string `yaml:"Right"`
+	// On are the key columns present in both the apps, element key or ColumnName, e.g. [securityId]
+	On []string `yaml:"On"`
+	// Mode is inner (default), left or asof. left keeps the records of the Left app without a match with N/A in the
+	// columns of the Right app. asof matches the latest record of the Right app whose Timestamp is not after the
+	// Timestamp of the Left record, the records of the Left app without a match are kept like left.
+	Mode string `yaml:"Mode"`
+	// Timestamp is the column of Type timestamp present in both the apps, it is required by asof
+	Timestamp string `yaml:"Timestamp"`
+}
+
+// verifyJoins verifies the Joins config, apps and columns of the joins are verified by verifyJoinColumns
+func (config *TocsvConfig) verifyJoins() error {
+	names := map[string]bool{}
+	for _, join := range config.Joins {
+		if len(join.Name) == 0 || len(join.Left) == 0 || len(join.Right) == 0 || len(join.On) == 0 {
+			return fmt.Errorf("please provide Name, Left, Right and On of the join, e.g. {Name: Fills, Left: Executions, Right: Orders, On: [orderId]}")
+		}
+		if names[join.Name] {
+			return fmt.Errorf("Name of the join %s is repeated", join.Name)
+		}
+		names[join.Name] = true
+		if len(join.Mode) == 0 {
+			join.Mode = gJoinInner
+		}
+		if !findutils.ContainsString(gJoinModes, join.Mode) {
+			return fmt.Errorf("unknown Mode %q of the join %s, supported modes are %s", join.Mode, join.Name,
+				strings.Join(gJoinModes, ", "))
+		}
+		if join.Mode == gJoinAsof && len(join.Timestamp) == 0 {
+			return fmt.Errorf("please provide Timestamp of the join %s for Mode %s", join.Name, gJoinAsof)
+		}
+	}
+	return nil
+}
+
+// verifyJoinColumns verifies that the apps and the columns of the joins are present in the config of the apps, headers
+// are the columns of each app
+func (config *TocsvConfig) verifyJoinColumns(headers map[string][]*filterlogs.MetaInfoType) error {
+	for _, join := range config.Joins {
+		for _, appName := range []string{join.Left, join.Right} {
+			header, exists := headers[appName]
+			if !exists {
+				return fmt.Errorf("app %s of the join %s is not found", appName, join.Name)
+			}
+			if _, err := newJoinSide(appName, header, join); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isJoinedApp returns true if the records of the app are used by a join
+func (config *TocsvConfig) isJoinedApp(appName string) bool {
+	for _, join := range config.Joins {
+		if join.Left == appName || join.Right == appName {
+			return true
+		}
+	}
+	return false
+}
+
+// columnIndex returns the index of the column given by its element key or ColumnName, -1 if it is not found
+func columnIndex(header []*filterlogs.MetaInfoType, column string) int {
+	for i, metaInfo := range header {
+		if metaInfo.ElementKey == column || metaInfo.ColumnName == column {
+			return i
+		}
+	}
+	return -1
+}
+
+// joinSide is one of the apps of a join along with the indexes of its key and timestamp columns
+type joinSide struct {
+	header         []*filterlogs.MetaInfoType
+	records        [][]*filterlogs.FilteredData // values of the header of each record of the app
+	keyIndex       []int
+	timestampIndex int
+}
+
+func newJoinSide(appName string, header []*filterlogs.MetaInfoType, join *JoinConfig) (*joinSide, error) {
+	side := &joinSide{header: header, timestampIndex: -1}
+	for _, column := range join.On {
+		i := columnIndex(header, column)
+		if i < 0 {
+			return nil, fmt.Errorf("column %s of app %s is not found for the join %s", column, appName, join.Name)
+		}
+		side.keyIndex = append(side.keyIndex, i)
+	}
+	if len(join.Timestamp) > 0 {
+		side.timestampIndex = columnIndex(header, join.Timestamp)
+		if side.timestampIndex < 0 || header[side.timestampIndex].Type != filterlogs.TypeTimestamp {
+			return nil, fmt.Errorf("column %s of Type %s of app %s is not found for the join %s", join.Timestamp,
+				filterlogs.TypeTimestamp, appName, join.Name)
+		}
+	}
+	return side, nil
+}
+
+// key returns the values of the key columns of the record, false is returned if any of them is N/A or N/F
+func (side *joinSide) key(record []*filterlogs.FilteredData) (string, bool) {
+	values := make([]string, len(side.keyIndex))
+	for i, index := range side.keyIndex {
+		if record[index] == nil || record[index].Text == filterlogs.NotFound {
+			return "", false
+		}
+		values[i] = record[index].Text
+	}
+	return strings.Join(values, "\x00"), true
+}
+
+func (side *joinSide) timestamp(record []*filterlogs.FilteredData) (time.Time, bool) {
+	if record[side.timestampIndex] == nil {
+		return time.Time{}, false
+	}
+	timestamp, ok := record[side.timestampIndex].Value.(time.Time)
+	return timestamp, ok
+}
+
+// joinColumns returns the columns of the joined records, all the columns of the Left app followed by the columns of
+// the Right app except its key columns. Columns of the Right app whose name is used by the Left app are prefixed with
+// its AppName, e.g. Orders.timestamp.
+func joinColumns(join *JoinConfig, left, right *joinSide) []*filterlogs.MetaInfoType {
+	columns := append([]*filterlogs.MetaInfoType{}, left.header...)
+	used := map[string]bool{}
+	for _, name := range columnNames(columns) {
+		used[name] = true
+	}
+	for i, metaInfo := range right.header {
+		if containsInt(right.keyIndex, i) {
+			continue
+		}
+		column := *metaInfo
+		if used[columnName(&column)] {
+			column.ColumnName = join.Right + "." + columnName(&column)
+		}
+		columns = append(columns, &column)
+	}
+	return columns
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// joinRecords returns the joined records in the order of the records of the Left app
+func joinRecords(join *JoinConfig, left, right *joinSide) [][]*filterlogs.FilteredData {
+	rightRecords := map[string][][]*filterlogs.FilteredData{}
+	for _, record := range right.records {
+		if key, ok := right.key(record); ok {
+			rightRecords[key] = append(rightRecords[key], record)
+		}
+	}
+	if join.Mode == gJoinAsof {
+		// records of each key are sorted by their timestamps to find the latest record before a timestamp
+		for key, records := range rightRecords {
+			sorted := records[:0]
+			for _, record := range records {
+				if _, ok := right.timestamp(record); ok {
+					sorted = append(sorted, record)
+				}
+			}
+			sort.SliceStable(sorted, func(i, j int) bool {
+				ti, _ := right.timestamp(sorted[i])
+				tj, _ := right.timestamp(sorted[j])
+				return ti.Before(tj)
+			})
+			rightRecords[key] = sorted
+		}
+	}
+
+	joined := [][]*filterlogs.FilteredData{}
+	addRecord := func(leftRecord, rightRecord []*filterlogs.FilteredData) {
+		record := append([]*filterlogs.FilteredData{}, leftRecord...)
+		for i := range right.header {
+			if containsInt(right.keyIndex, i) {
+				continue
+			}
+			if rightRecord == nil {
+				// nil is N/A
+				record = append(record, nil)
+			} else {
+				record = append(record, rightRecord[i])
+			}
+		}
+		joined = append(joined, record)
+	}
+	for _, leftRecord := range left.records {
+		key, ok := left.key(leftRecord)
+		matches := rightRecords[key]
+		if !ok {
+			matches = nil
+		}
+		switch join.Mode {
+		case gJoinAsof:
+			var match []*filterlogs.FilteredData
+			if timestamp, found := left.timestamp(leftRecord); found {
+				// index of the first record after the timestamp
+				i := sort.Search(len(matches), func(i int) bool {
+					t, _ := right.timestamp(matches[i])
+					return t.After(timestamp)
+				})
+				if i > 0 {
+					match = matches[i-1]
+				}
+			}
+			addRecord(leftRecord, match)
+		default:
+			for _, match := range matches {
+				addRecord(leftRecord, match)
+			}
+			if len(matches) == 0 && join.Mode == gJoinLeft {
+				addRecord(leftRecord, nil)
+			}
+		}
+	}
+	return joined
+}
+
+// writeJoins writes the output of each join after reading all the input. The records of the Left app are written
+// with N/A by the left and asof modes if there are no records of the Right app.
+func (a *Tocsv) writeJoins() {
+	for _, join := range a.Config.Joins {
+		leftData, leftExists := a.AppData[join.Left]
+		rightData, rightExists := a.AppData[join.Right]
+		if !leftExists || (!rightExists && join.Mode == gJoinInner) {
+			fmt.Println("WARN, join", join.Name, "is not written as there are no records of", join.Left, "or", join.Right)
+			continue
+		}
+		// columns are verified by verifyJoinColumns
+		left, err := newJoinSide(join.Left, a.headers[join.Left], join)
+		if errorutils.PrintOnErr("ERROR in join "+join.Name, err) {
+			continue
+		}
+		right, err := newJoinSide(join.Right, a.headers[join.Right], join)
+		if errorutils.PrintOnErr("ERROR in join "+join.Name, err) {
+			continue
+		}
+		left.records = leftData.joinData
+		if rightExists {
+			right.records = rightData.joinData
+		}
+		a.writeTable(join.Name, joinColumns(join, left, right), joinRecords(join, left, right))
+	}
+}
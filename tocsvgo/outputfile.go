@@ -0,0 +1,223 @@
+package tocsvgo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"tocsv/logparser"
+
+	"github.com/parmaanu/goutils/findutils"
+)
+
+// Placeholders of the OutputFileTemplate, time placeholders take an optional go layout e.g. {run:2006-01-02}
+const (
+	gPlaceholderApp   = "app"
+	gPlaceholderTag   = "tag"
+	gPlaceholderInput = "input"
+	gPlaceholderFirst = "first"
+	gPlaceholderLast  = "last"
+	gPlaceholderRun   = "run"
+	gPlaceholderExt   = "ext"
+
+	gDefaultOutputFileTemplate = "{app}.{run}.{ext}"
+	gRunLayout                 = "20060102" // YYYYMMDD format
+	gRecordTimestampLayout     = "20060102T150405"
+	gUnknownTimestamp          = "NA"
+	gStdinInputName            = "stdin"
+	gPartialFileSuffix         = ".partial"
+)
+
+var gPlaceholders = []string{gPlaceholderApp, gPlaceholderTag, gPlaceholderInput, gPlaceholderFirst, gPlaceholderLast, gPlaceholderRun, gPlaceholderExt}
+var gTimePlaceholders = []string{gPlaceholderFirst, gPlaceholderLast, gPlaceholderRun}
+
+// Policies of OnOutputFileExists
+const (
+	gOnFileExistsOverwrite = "overwrite"
+	gOnFileExistsAppend    = "append"
+	gOnFileExistsUnique    = "unique"
+)
+
+var gOnFileExistsPolicies = []string{gOnFileExistsOverwrite, gOnFileExistsAppend, gOnFileExistsUnique}
+
+// templatePart is either a literal text or a placeholder of the OutputFileTemplate
+type templatePart struct {
+	text        string
+	placeholder string
+	layout      string
+}
+
+// outputTemplate is a parsed OutputFileTemplate
+type outputTemplate struct {
+	parts []templatePart
+}
+
+func parseOutputTemplate(template string) (*outputTemplate, error) {
+	t := &outputTemplate{}
+	rest := template
+	for len(rest) > 0 {
+		start := strings.Index(rest, "{")
+		if start == -1 {
+			t.parts = append(t.parts, templatePart{text: rest})
+			break
+		}
+		if start > 0 {
+			t.parts = append(t.parts, templatePart{text: rest[:start]})
+		}
+		end := strings.Index(rest[start:], "}")
+		if end == -1 {
+			return nil, fmt.Errorf("placeholder is not closed in %q", template)
+		}
+		placeholder := rest[start+1 : start+end]
+		layout := ""
+		if i := strings.Index(placeholder, ":"); i > -1 {
+			placeholder, layout = placeholder[:i], placeholder[i+1:]
+			if !findutils.ContainsString(gTimePlaceholders, placeholder) {
+				return nil, fmt.Errorf("layout can only be given for %s placeholders, found {%s:%s}",
+					strings.Join(gTimePlaceholders, ", "), placeholder, layout)
+			}
+		}
+		if !findutils.ContainsString(gPlaceholders, placeholder) {
+			return nil, fmt.Errorf("unknown placeholder {%s}, supported placeholders are {%s}", placeholder,
+				strings.Join(gPlaceholders, "}, {"))
+		}
+		t.parts = append(t.parts, templatePart{placeholder: placeholder, layout: layout})
+		rest = rest[start+end+1:]
+	}
+	if len(t.parts) == 0 {
+		return nil, fmt.Errorf("empty template")
+	}
+	return t, nil
+}
+
+// uses returns true if any of the placeholders is used in the template
+func (t *outputTemplate) uses(placeholders ...string) bool {
+	for _, part := range t.parts {
+		if findutils.ContainsString(placeholders, part.placeholder) {
+			return true
+		}
+	}
+	return false
+}
+
+// outputFileFields are the values of the placeholders for an output file. first and last are zero until a record
+// with a timestamp is written.
+type outputFileFields struct {
+	app, tag, input, ext string
+	run, first, last     time.Time
+}
+
+// inputName returns the basename of the input file used in the {input} placeholder
+func inputName(source string) string {
+	if len(source) == 0 || source == logparser.StdinSource {
+		return gStdinInputName
+	}
+	return filepath.Base(source)
+}
+
+// fileNameValue replaces the path separators so that a value of a placeholder does not create directories
+func fileNameValue(value string) string {
+	return strings.NewReplacer("/", "_", `\`, "_").Replace(value)
+}
+
+func (t *outputTemplate) expand(fields *outputFileFields) string {
+	var sb strings.Builder
+	for _, part := range t.parts {
+		switch part.placeholder {
+		case "":
+			sb.WriteString(part.text)
+		case gPlaceholderApp:
+			sb.WriteString(fileNameValue(fields.app))
+		case gPlaceholderTag:
+			sb.WriteString(fileNameValue(fields.tag))
+		case gPlaceholderInput:
+			sb.WriteString(fileNameValue(fields.input))
+		case gPlaceholderExt:
+			sb.WriteString(fields.ext)
+		case gPlaceholderRun:
+			sb.WriteString(formatTimePlaceholder(fields.run, part.layout, gRunLayout))
+		case gPlaceholderFirst:
+			sb.WriteString(formatTimePlaceholder(fields.first, part.layout, gRecordTimestampLayout))
+		case gPlaceholderLast:
+			sb.WriteString(formatTimePlaceholder(fields.last, part.layout, gRecordTimestampLayout))
+		}
+	}
+	return sb.String()
+}
+
+func formatTimePlaceholder(t time.Time, layout, defaultLayout string) string {
+	if t.IsZero() {
+		return gUnknownTimestamp
+	}
+	if len(layout) == 0 {
+		layout = defaultLayout
+	}
+	return fileNameValue(t.Format(layout))
+}
+
+// key returns the key of the output in OutputCsvMap, it is the AppName followed by the tag and the input file if they
+// are used in the template to write separate files
+func (t *outputTemplate) key(fields *outputFileFields) string {
+	key := fields.app
+	if t.uses(gPlaceholderTag) {
+		key += "/" + fields.tag
+	}
+	if t.uses(gPlaceholderInput) {
+		key += "/" + fields.input
+	}
+	return key
+}
+
+// uniqueFileName returns fname if it does not exist, otherwise a numeric suffix is added before the extension, e.g.
+// Orders.20201231.1.csv
+func uniqueFileName(fname string) string {
+	if _, err := os.Stat(fname); os.IsNotExist(err) {
+		return fname
+	}
+	ext := filepath.Ext(fname)
+	base := strings.TrimSuffix(fname, ext)
+	for i := 1; ; i++ {
+		candidate := base + "." + strconv.Itoa(i) + ext
+		if _, err := os.Stat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+	}
+}
+
+// verifyOutputFileConfig verifies the OutputFileTemplate along with OnOutputFileExists and OnHeaderMismatch
+func (config *TocsvConfig) verifyOutputFileConfig() (*outputTemplate, error) {
+	template := config.OutputFileTemplate
+	if len(template) == 0 {
+		template = gDefaultOutputFileTemplate
+	}
+	t, err := parseOutputTemplate(template)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OutputFileTemplate, %s", err)
+	}
+	if len(config.OnOutputFileExists) == 0 {
+		config.OnOutputFileExists = gOnFileExistsOverwrite
+	}
+	if !findutils.ContainsString(gOnFileExistsPolicies, config.OnOutputFileExists) {
+		return nil, fmt.Errorf("unknown OnOutputFileExists %q, supported policies are %s", config.OnOutputFileExists,
+			strings.Join(gOnFileExistsPolicies, ", "))
+	}
+	if len(config.OnHeaderMismatch) == 0 {
+		config.OnHeaderMismatch = gOnHeaderMismatchStrict
+	}
+	if !findutils.ContainsString(gOnHeaderMismatchPolicies, config.OnHeaderMismatch) {
+		return nil, fmt.Errorf("unknown OnHeaderMismatch %q, supported policies are %s", config.OnHeaderMismatch,
+			strings.Join(gOnHeaderMismatchPolicies, ", "))
+	}
+	if config.OnOutputFileExists == gOnFileExistsAppend {
+		if t.uses(gPlaceholderFirst, gPlaceholderLast) {
+			return nil, fmt.Errorf("OnOutputFileExists %s cannot be used with {%s} or {%s} in OutputFileTemplate",
+				gOnFileExistsAppend, gPlaceholderFirst, gPlaceholderLast)
+		}
+		if config.Format == FormatParquet {
+			return nil, fmt.Errorf("OnOutputFileExists %s is not supported by the %s format", gOnFileExistsAppend, FormatParquet)
+		}
+	}
+	return t, nil
+}
@@ -0,0 +1,239 @@
+package tocsvgo
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"tocsv/filterlogs"
+
+	"github.com/parmaanu/goutils/findutils"
+)
+
+// PairConfig stores the config of the pairs of the records of two tags of an app, e.g. an order sent and its reply.
+// Each pair is written with the timestamps of both the records and the latency in an additional output named Name,
+// the starts without an end are written in an output named UnmatchedName.
+type PairConfig struct {
+	// Name of the output of the pairs, it is used as the AppName in OutputFileTemplate
+	Name string `yaml:"Name"`
+	// App is the AppName whose records are paired
+	App string `yaml:"App"`
+	// Start and End are the tags of the loglines, each record of End is paired with the oldest record of Start having
+	// the same values of On which is not paired yet
+	Start string `yaml:"Start"`
+	End   string `yaml:"End"`
+	// On are the correlation columns, element key or ColumnName, e.g. [orderId]
+	On []string `yaml:"On"`
+	// Timestamp is the column of Type timestamp of the app used for the latency
+	Timestamp string `yaml:"Timestamp"`
+	// Timeout is the maximum latency of a pair, e.g. 5s. A start without an end within the Timeout is unmatched. Starts
+	// without an end till the end of the input are also unmatched. There is no Timeout if it is empty.
+	Timeout string `yaml:"Timeout"`
+	// UnmatchedName is the name of the output of the unmatched starts, default is Name followed by Unmatched
+	UnmatchedName string `yaml:"UnmatchedName"`
+
+	timeout time.Duration
+}
+
+// verifyPairs verifies the Pairs config, apps, tags and columns of the pairs are verified by newPairers
+func (config *TocsvConfig) verifyPairs() error {
+	names := map[string]bool{}
+	for _, join := range config.Joins {
+		names[join.Name] = true
+	}
+	for _, aggregation := range config.Aggregations {
+		names[aggregation.Name] = true
+	}
+	for _, pair := range config.Pairs {
+		if len(pair.Name) == 0 || len(pair.App) == 0 || len(pair.Start) == 0 || len(pair.End) == 0 ||
+			len(pair.On) == 0 || len(pair.Timestamp) == 0 {
+			return fmt.Errorf("please provide Name, App, Start, End, On and Timestamp of the pair, e.g. {Name: OrderLatency, App: Orders, Start: SENT, End: REPLY, On: [orderId], Timestamp: timestamp}")
+		}
+		if pair.Start == pair.End {
+			return fmt.Errorf("Start and End of the pair %s should be different tags", pair.Name)
+		}
+		if len(pair.UnmatchedName) == 0 {
+			pair.UnmatchedName = pair.Name + "Unmatched"
+		}
+		for _, name := range []string{pair.Name, pair.UnmatchedName} {
+			if names[name] {
+				return fmt.Errorf("Name %s of the pair is already used by another pair, aggregation or join", name)
+			}
+			names[name] = true
+		}
+		if len(pair.Timeout) > 0 {
+			timeout, err := time.ParseDuration(pair.Timeout)
+			if err != nil || timeout <= 0 {
+				return fmt.Errorf("Timeout %q of the pair %s should be a positive duration, e.g. 5s", pair.Timeout, pair.Name)
+			}
+			pair.timeout = timeout
+		}
+	}
+	return nil
+}
+
+// newPairers returns the pairer of each pair, key is the Name of the pair. headers are the columns and tags are the
+// tags of the loglines of each app, an error is returned if the app, a tag or a column of a pair is not found.
+func (config *TocsvConfig) newPairers(headers map[string][]*filterlogs.MetaInfoType, tags map[string][]string) (map[string]*pairer, error) {
+	pairers := map[string]*pairer{}
+	for _, pair := range config.Pairs {
+		header, exists := headers[pair.App]
+		if !exists {
+			return nil, fmt.Errorf("app %s of the pair %s is not found", pair.App, pair.Name)
+		}
+		for _, tag := range []string{pair.Start, pair.End} {
+			if !findutils.ContainsString(tags[pair.App], tag) {
+				return nil, fmt.Errorf("tag %s of app %s is not found for the pair %s", tag, pair.App, pair.Name)
+			}
+		}
+		p, err := newPairer(pair, header)
+		if err != nil {
+			return nil, err
+		}
+		pairers[pair.Name] = p
+	}
+	return pairers, nil
+}
+
+// pendingStart is a record of the Start tag waiting for its End
+type pendingStart struct {
+	keyValues []*filterlogs.FilteredData
+	timestamp *filterlogs.FilteredData
+	seq       int // order of the record, used to write the unmatched starts in the order of the input
+}
+
+// pairer pairs the records of an app as they are received
+type pairer struct {
+	config         *PairConfig
+	header         []*filterlogs.MetaInfoType
+	keyIndex       []int
+	timestampIndex int
+	pending        map[string][]*pendingStart // starts waiting for their end, key is the values of On
+	pairs          [][]*filterlogs.FilteredData
+	unmatched      []*pendingStart
+	seq            int
+}
+
+func newPairer(config *PairConfig, header []*filterlogs.MetaInfoType) (*pairer, error) {
+	p := &pairer{config: config, header: header, pending: map[string][]*pendingStart{}}
+	for _, column := range config.On {
+		i := columnIndex(header, column)
+		if i < 0 {
+			return nil, fmt.Errorf("column %s of app %s is not found for the pair %s", column, config.App, config.Name)
+		}
+		p.keyIndex = append(p.keyIndex, i)
+	}
+	p.timestampIndex = columnIndex(header, config.Timestamp)
+	if p.timestampIndex < 0 || header[p.timestampIndex].Type != filterlogs.TypeTimestamp {
+		return nil, fmt.Errorf("column %s of Type %s of app %s is not found for the pair %s", config.Timestamp,
+			filterlogs.TypeTimestamp, config.App, config.Name)
+	}
+	return p, nil
+}
+
+// add pairs the record of the tag, record contains the values of the header. Records without the values of On or the
+// Timestamp are ignored, values which are N/A or N/F are not found.
+func (p *pairer) add(tag string, record []*filterlogs.FilteredData) {
+	if tag != p.config.Start && tag != p.config.End {
+		return
+	}
+	timestamp := record[p.timestampIndex]
+	if timestamp == nil {
+		return
+	}
+	t, ok := timestamp.Value.(time.Time)
+	if !ok {
+		return
+	}
+	keyValues := make([]*filterlogs.FilteredData, len(p.keyIndex))
+	texts := make([]string, len(p.keyIndex))
+	for i, index := range p.keyIndex {
+		if record[index] == nil || record[index].Text == filterlogs.NotFound {
+			return
+		}
+		keyValues[i] = record[index]
+		texts[i] = record[index].Text
+	}
+	key := strings.Join(texts, "\x00")
+
+	if tag == p.config.Start {
+		p.pending[key] = append(p.pending[key], &pendingStart{keyValues: keyValues, timestamp: timestamp, seq: p.seq})
+		p.seq++
+		return
+	}
+	starts := p.pending[key]
+	// starts older than the Timeout cannot be paired with this or any later end
+	for len(starts) > 0 && p.config.timeout > 0 && t.Sub(starts[0].timestamp.Value.(time.Time)) > p.config.timeout {
+		p.unmatched = append(p.unmatched, starts[0])
+		starts = starts[1:]
+	}
+	if len(starts) == 0 {
+		delete(p.pending, key)
+		return
+	}
+	start := starts[0]
+	if len(starts) == 1 {
+		delete(p.pending, key)
+	} else {
+		p.pending[key] = starts[1:]
+	}
+	latency := t.Sub(start.timestamp.Value.(time.Time))
+	pair := append(append([]*filterlogs.FilteredData{}, start.keyValues...), start.timestamp, timestamp,
+		&filterlogs.FilteredData{Text: latency.String(), Value: latency})
+	p.pairs = append(p.pairs, pair)
+}
+
+// columns returns the columns of the pairs and the unmatched starts, On columns followed by the timestamps named by
+// the tags, e.g. SENT.timestamp
+func (p *pairer) columns() (pairColumns, unmatchedColumns []*filterlogs.MetaInfoType) {
+	for _, index := range p.keyIndex {
+		pairColumns = append(pairColumns, p.header[index])
+	}
+	timestampColumn := func(tag string) *filterlogs.MetaInfoType {
+		column := *p.header[p.timestampIndex]
+		column.ColumnName = tag + "." + columnName(&column)
+		return &column
+	}
+	unmatchedColumns = append(append([]*filterlogs.MetaInfoType{}, pairColumns...), timestampColumn(p.config.Start))
+	pairColumns = append(pairColumns, timestampColumn(p.config.Start), timestampColumn(p.config.End),
+		&filterlogs.MetaInfoType{ElementKey: "latency", Type: filterlogs.TypeDuration})
+	return pairColumns, unmatchedColumns
+}
+
+// unmatchedRecords returns the starts without an end in the order of the input, the pending starts are unmatched as
+// all the input is read
+func (p *pairer) unmatchedRecords() [][]*filterlogs.FilteredData {
+	starts := append([]*pendingStart{}, p.unmatched...)
+	for _, pending := range p.pending {
+		starts = append(starts, pending...)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i].seq < starts[j].seq })
+	records := [][]*filterlogs.FilteredData{}
+	for _, start := range starts {
+		records = append(records, append(append([]*filterlogs.FilteredData{}, start.keyValues...), start.timestamp))
+	}
+	return records
+}
+
+// pairRecord adds the record of the app to its pairs, record contains the values of the header of the app
+func (a *Tocsv) pairRecord(appName, tag string, record []*filterlogs.FilteredData) {
+	for _, config := range a.Config.Pairs {
+		if config.App == appName {
+			a.pairers[config.Name].add(tag, record)
+		}
+	}
+}
+
+// writePairs writes the pairs and the unmatched starts of each pair config after reading all the input
+func (a *Tocsv) writePairs() {
+	for _, config := range a.Config.Pairs {
+		if _, exists := a.AppData[config.App]; !exists {
+			fmt.Println("WARN, pair", config.Name, "is not written as there are no records of", config.App)
+			continue
+		}
+		p := a.pairers[config.Name]
+		pairColumns, unmatchedColumns := p.columns()
+		a.writeTable(config.Name, pairColumns, p.pairs)
+		a.writeTable(config.UnmatchedName, unmatchedColumns, p.unmatchedRecords())
+	}
+}
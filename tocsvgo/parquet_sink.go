@@ -0,0 +1,133 @@
+package tocsvgo
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+	"tocsv/filterlogs"
+
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+const (
+	gDefaultParquetRowGroupSizeMB = 128
+	// gParquetParallelism is the number of goroutines used to marshal the records of a row group
+	gParquetParallelism = 4
+)
+
+var gParquetCompressions = map[string]parquet.CompressionCodec{
+	"snappy":       parquet.CompressionCodec_SNAPPY,
+	"gzip":         parquet.CompressionCodec_GZIP,
+	"zstd":         parquet.CompressionCodec_ZSTD,
+	"uncompressed": parquet.CompressionCodec_UNCOMPRESSED,
+}
+
+// verify verifies the parquet options, nil config is valid and uses the defaults
+func (pc *ParquetConfig) verify() error {
+	if pc == nil {
+		return nil
+	}
+	if pc.RowGroupSize < 0 {
+		return fmt.Errorf("RowGroupSize cannot be negative, %d", pc.RowGroupSize)
+	}
+	if _, exists := gParquetCompressions[strings.ToLower(pc.Compression)]; len(pc.Compression) > 0 && !exists {
+		return fmt.Errorf("unknown Compression %q, supported compressions are snappy, gzip, zstd and uncompressed", pc.Compression)
+	}
+	return nil
+}
+
+// parquetSink writes the records of an app in a parquet file. Schema is derived from the output columns, columns of
+// the typed elements are written with their types and the rest as strings. All the columns are optional, N/A, N/F and
+// the values which cannot be parsed are written as nulls.
+type parquetSink struct {
+	file    *os.File
+	columns []*filterlogs.MetaInfoType
+	writer  *writer.CSVWriter
+}
+
+func newParquetSink(w io.Writer, file *os.File, columns []*filterlogs.MetaInfoType, config *ParquetConfig) (*parquetSink, error) {
+	schema := make([]string, 0, len(columns))
+	for _, metaInfo := range columns {
+		schema = append(schema, parquetColumnSchema(metaInfo))
+	}
+	pw, err := writer.NewCSVWriterFromWriter(schema, w, gParquetParallelism)
+	if err != nil {
+		return nil, err
+	}
+	pw.RowGroupSize = gDefaultParquetRowGroupSizeMB * 1024 * 1024
+	if config != nil && config.RowGroupSize > 0 {
+		pw.RowGroupSize = config.RowGroupSize * 1024 * 1024
+	}
+	if config != nil && len(config.Compression) > 0 {
+		pw.CompressionType = gParquetCompressions[strings.ToLower(config.Compression)]
+	}
+	return &parquetSink{file: file, columns: columns, writer: pw}, nil
+}
+
+// parquetColumnSchema returns the schema of the column in the metadata format of parquet-go. Decimals are stored as
+// doubles, durations as int64 nanoseconds and timestamps as microseconds since epoch.
+func parquetColumnSchema(metaInfo *filterlogs.MetaInfoType) string {
+	var columnType string
+	switch metaInfo.Type {
+	case filterlogs.TypeInt, filterlogs.TypeDuration:
+		columnType = "type=INT64"
+	case filterlogs.TypeFloat, filterlogs.TypeDecimal:
+		columnType = "type=DOUBLE"
+	case filterlogs.TypeBool:
+		columnType = "type=BOOLEAN"
+	case filterlogs.TypeTimestamp:
+		columnType = "type=INT64, convertedtype=TIMESTAMP_MICROS"
+	default:
+		columnType = "type=BYTE_ARRAY, convertedtype=UTF8"
+	}
+	return fmt.Sprintf("name=%s, %s, repetitiontype=OPTIONAL", columnName(metaInfo), columnType)
+}
+
+func (s *parquetSink) write(record []*filterlogs.FilteredData) error {
+	values := make([]interface{}, len(record))
+	for i, filteredData := range record {
+		values[i] = parquetValue(s.columns[i], filteredData)
+	}
+	return s.writer.Write(values)
+}
+
+// parquetValue converts the value of the element into the go type of its parquet column
+func parquetValue(metaInfo *filterlogs.MetaInfoType, filteredData *filterlogs.FilteredData) interface{} {
+	if filteredData == nil {
+		return nil
+	}
+	if len(metaInfo.Type) == 0 {
+		return filteredData.Text
+	}
+	switch value := filteredData.Value.(type) {
+	case int64, float64, bool:
+		return value
+	case *big.Rat:
+		f, _ := value.Float64()
+		return f
+	case time.Duration:
+		return int64(value)
+	case time.Time:
+		return value.UnixNano() / int64(time.Microsecond)
+	}
+	return nil
+}
+
+// flush does nothing as the records are written when a row group is complete
+func (s *parquetSink) flush() error {
+	return nil
+}
+
+func (s *parquetSink) close() error {
+	err := s.writer.WriteStop()
+	if s.file != nil {
+		if closeErr := s.file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
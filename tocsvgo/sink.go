@@ -0,0 +1,270 @@
+package tocsvgo
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"os"
+	"regexp"
+	"strings"
+	"tocsv/filterlogs"
+
+	"github.com/parmaanu/goutils/findutils"
+)
+
+// Output formats supported by tocsv
+const (
+	FormatCsv     = "csv"
+	FormatJSONL   = "jsonl"
+	FormatParquet = "parquet"
+	FormatSqlite  = "sqlite"
+	FormatXlsx    = "xlsx"
+)
+
+var gFormats = []string{FormatCsv, FormatJSONL, FormatParquet, FormatSqlite, FormatXlsx}
+
+// gFileOnlyFormats are the binary formats which cannot be printed on stdout
+var gFileOnlyFormats = []string{FormatParquet, FormatSqlite, FormatXlsx}
+
+// gSingleFileFormats are the formats which write the outputs of all the apps in a single file
+var gSingleFileFormats = []string{FormatSqlite, FormatXlsx}
+
+func isValidFormat(format string) bool {
+	return findutils.ContainsString(gFormats, format)
+}
+
+func isFileOnlyFormat(format string) bool {
+	return findutils.ContainsString(gFileOnlyFormats, format)
+}
+
+func isSingleFileFormat(format string) bool {
+	return findutils.ContainsString(gSingleFileFormats, format)
+}
+
+// columnName returns the ColumnName of the output column, ElementKey is used if ColumnName is not provided
+func columnName(metaInfo *filterlogs.MetaInfoType) string {
+	if len(metaInfo.ColumnName) > 0 {
+		return metaInfo.ColumnName
+	}
+	return metaInfo.ElementKey
+}
+
+func columnNames(columns []*filterlogs.MetaInfoType) []string {
+	names := make([]string, 0, len(columns))
+	for _, metaInfo := range columns {
+		names = append(names, columnName(metaInfo))
+	}
+	return names
+}
+
+// sink writes the records of an app to an output as soon as they are received. Sinks which need all the records
+// before writing anything buffer them on their own. Values of a record are in the order of the header, a nil value
+// means the element is not applicable (N/A) for the record.
+type sink interface {
+	write(record []*filterlogs.FilteredData) error
+	// flush writes the buffered records to the output
+	flush() error
+	close() error
+}
+
+// newSink returns the sink of the configured Format, file is closed along with the sink and it is nil when the output
+// is stdout. columns are the output columns in order, header is not written if writeHeader is false e.g. while
+// appending to an existing file.
+func newSink(config *TocsvConfig, w io.Writer, file *os.File, columns []*filterlogs.MetaInfoType, writeHeader bool) (sink, error) {
+	switch config.Format {
+	case FormatCsv:
+		return newCsvSink(w, file, columnNames(columns), writeHeader)
+	case FormatJSONL:
+		return newJSONLSink(w, file, columnNames(columns)), nil
+	case FormatParquet:
+		return newParquetSink(w, file, columns, config.Parquet)
+	}
+	return nil, fmt.Errorf("unknown format %q, supported formats are %s", config.Format, strings.Join(gFormats, ", "))
+}
+
+// container stores the outputs of all the apps in a single file, e.g. a sqlite database or an excel workbook. Each app writes its records
+// using its own sink from the container.
+type container interface {
+	newSink(appName string, columns []*filterlogs.MetaInfoType) (sink, error)
+	close() error
+}
+
+// newContainer returns the container of the configured Format
+func newContainer(config *TocsvConfig, fname string) (container, error) {
+	switch config.Format {
+	case FormatSqlite:
+		return newSqliteDatabase(fname, config.Sqlite)
+	case FormatXlsx:
+		return newXlsxWorkbook(fname)
+	}
+	return nil, fmt.Errorf("format %q does not write all the apps in a single file", config.Format)
+}
+
+// reorderSink writes the records in the order of the columns of an existing output, columnIndex is the index of each
+// output column in the record, -1 is N/A
+type reorderSink struct {
+	sink
+	columnIndex []int
+}
+
+func (s *reorderSink) write(record []*filterlogs.FilteredData) error {
+	outputRecord := make([]*filterlogs.FilteredData, len(s.columnIndex))
+	for i, index := range s.columnIndex {
+		if index >= 0 {
+			outputRecord[i] = record[index]
+		}
+	}
+	return s.sink.write(outputRecord)
+}
+
+// csvSink writes the records in csv format, the header is written when the sink is created
+type csvSink struct {
+	file   *os.File
+	writer *csv.Writer
+}
+
+func newCsvSink(w io.Writer, file *os.File, header []string, writeHeader bool) (*csvSink, error) {
+	s := &csvSink{file: file, writer: csv.NewWriter(w)}
+	if !writeHeader {
+		return s, nil
+	}
+	if err := s.writer.Write(header); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *csvSink) write(record []*filterlogs.FilteredData) error {
+	// values with commas or quotes, e.g. the loglines, are quoted by the csv writer
+	outputRecord := make([]string, 0, len(record))
+	for _, filteredData := range record {
+		if filteredData == nil {
+			outputRecord = append(outputRecord, "N/A")
+		} else {
+			outputRecord = append(outputRecord, filteredData.Text)
+		}
+	}
+	return s.writer.Write(outputRecord)
+}
+
+func (s *csvSink) flush() error {
+	s.writer.Flush()
+	return s.writer.Error()
+}
+
+func (s *csvSink) close() error {
+	err := s.flush()
+	if s.file != nil {
+		if closeErr := s.file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// jsonlSink writes each record as a json object in a line, keys are the column names in the order of the header.
+// Numbers and booleans of the typed elements are written as json numbers and booleans, N/A values are null.
+type jsonlSink struct {
+	file   *os.File
+	writer *bufio.Writer
+	keys   [][]byte // json encoded column names
+	line   bytes.Buffer
+}
+
+var gJSONNumberRegex = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+func newJSONLSink(w io.Writer, file *os.File, header []string) *jsonlSink {
+	s := &jsonlSink{file: file, writer: bufio.NewWriter(w)}
+	for _, columnName := range header {
+		key, _ := json.Marshal(columnName)
+		s.keys = append(s.keys, key)
+	}
+	return s
+}
+
+// write encodes the record in a line first so that a value which cannot be encoded does not leave a partial object
+// in the output
+func (s *jsonlSink) write(record []*filterlogs.FilteredData) error {
+	s.line.Reset()
+	s.line.WriteByte('{')
+	for i, filteredData := range record {
+		if i > 0 {
+			s.line.WriteByte(',')
+		}
+		s.line.Write(s.keys[i])
+		s.line.WriteByte(':')
+		value, err := json.Marshal(jsonValue(filteredData))
+		if err != nil {
+			return err
+		}
+		s.line.Write(value)
+	}
+	s.line.WriteString("}\n")
+	_, err := s.writer.Write(s.line.Bytes())
+	return err
+}
+
+// jsonValue returns the value of the element to be encoded in json, NaN and infinite floats are null
+func jsonValue(filteredData *filterlogs.FilteredData) interface{} {
+	if filteredData == nil {
+		return nil
+	}
+	switch value := filteredData.Value.(type) {
+	case int64, bool:
+		return value
+	case float64:
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return nil
+		}
+		return value
+	case *big.Rat:
+		return jsonDecimal(filteredData.Text, value)
+	}
+	return filteredData.Text
+}
+
+// jsonDecimal returns the decimal as a json number. Decimals are written as they are found in the logline to keep
+// their precision if it is a valid json number, e.g. 123.10, otherwise the exact decimal digits of the value are
+// written, e.g. .5 is written as 0.5. A decimal without exact digits, e.g. 1/3, is written as a string.
+func jsonDecimal(text string, value *big.Rat) interface{} {
+	if gJSONNumberRegex.MatchString(text) {
+		return json.Number(text)
+	}
+	// a fraction has exact decimal digits if its denominator has no prime factors other than 2 and 5
+	denom := new(big.Int).Set(value.Denom())
+	twos, fives := 0, 0
+	two, five, zero := big.NewInt(2), big.NewInt(5), big.NewInt(0)
+	for r := new(big.Int); r.Mod(denom, two).Cmp(zero) == 0; twos++ {
+		denom.Quo(denom, two)
+	}
+	for r := new(big.Int); r.Mod(denom, five).Cmp(zero) == 0; fives++ {
+		denom.Quo(denom, five)
+	}
+	if !denom.IsInt64() || denom.Int64() != 1 {
+		return text
+	}
+	digits := twos
+	if fives > digits {
+		digits = fives
+	}
+	return json.Number(value.FloatString(digits))
+}
+
+func (s *jsonlSink) flush() error {
+	return s.writer.Flush()
+}
+
+func (s *jsonlSink) close() error {
+	err := s.flush()
+	if s.file != nil {
+		if closeErr := s.file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,277 @@
+package tocsvgo
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+	"tocsv/filterlogs"
+
+	"github.com/parmaanu/goutils/findutils"
+
+	// registers the sqlite3 driver
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const (
+	gSqliteModeAppend  = "append"
+	gSqliteModeReplace = "replace"
+
+	gDefaultSqliteBatchSize = 10000
+)
+
+// verify verifies the sqlite options, nil config is valid and uses the defaults
+func (sc *SqliteConfig) verify() error {
+	if sc == nil {
+		return nil
+	}
+	switch sc.Mode {
+	case "", gSqliteModeAppend, gSqliteModeReplace:
+	default:
+		return fmt.Errorf("unknown Mode %q, supported modes are %s and %s", sc.Mode, gSqliteModeAppend, gSqliteModeReplace)
+	}
+	if sc.BatchSize < 0 {
+		return fmt.Errorf("BatchSize cannot be negative, %d", sc.BatchSize)
+	}
+	for appName, indexes := range sc.Indexes {
+		for _, index := range indexes {
+			if len(index) == 0 {
+				return fmt.Errorf("empty index for app %s", appName)
+			}
+		}
+	}
+	return nil
+}
+
+// sqliteDatabase stores the tables of all the apps in a sqlite database. Rows of all the tables are inserted in a
+// single transaction which is committed after every BatchSize rows.
+type sqliteDatabase struct {
+	db        *sql.DB
+	tx        *sql.Tx
+	config    *SqliteConfig
+	batchSize int
+	pending   int
+	sinks     []*sqliteSink
+	txStmts   map[*sql.Stmt]*sql.Stmt // insert statements prepared for the current transaction
+}
+
+func newSqliteDatabase(fname string, config *SqliteConfig) (*sqliteDatabase, error) {
+	db, err := sql.Open("sqlite3", fname)
+	if err != nil {
+		return nil, err
+	}
+	// sqlite allows a single writer, so all the statements share one connection
+	db.SetMaxOpenConns(1)
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if config == nil {
+		config = &SqliteConfig{}
+	}
+	database := &sqliteDatabase{db: db, config: config, batchSize: gDefaultSqliteBatchSize}
+	if config.BatchSize > 0 {
+		database.batchSize = config.BatchSize
+	}
+	return database, nil
+}
+
+// quoteIdentifier quotes the table and column names so that any name can be used
+func quoteIdentifier(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// sqliteColumnType returns the sqlite type of the column. Timestamps are stored as text which can be used with the
+// date and time functions of sqlite.
+func sqliteColumnType(metaInfo *filterlogs.MetaInfoType) string {
+	switch metaInfo.Type {
+	case filterlogs.TypeInt, filterlogs.TypeDuration, filterlogs.TypeBool:
+		return "INTEGER"
+	case filterlogs.TypeFloat, filterlogs.TypeDecimal:
+		return "REAL"
+	}
+	return "TEXT"
+}
+
+// newSink creates the table of the app along with its indexes. Existing table is dropped in the replace Mode.
+func (database *sqliteDatabase) newSink(appName string, columns []*filterlogs.MetaInfoType) (sink, error) {
+	// tables are created outside of the transaction of the rows
+	if err := database.commit(); err != nil {
+		return nil, err
+	}
+	table := quoteIdentifier(appName)
+	if database.config.Mode == gSqliteModeReplace {
+		if _, err := database.db.Exec("DROP TABLE IF EXISTS " + table); err != nil {
+			return nil, err
+		}
+	}
+
+	names := columnNames(columns)
+	definitions := make([]string, 0, len(columns))
+	placeholders := make([]string, 0, len(columns))
+	for i, metaInfo := range columns {
+		definitions = append(definitions, quoteIdentifier(names[i])+" "+sqliteColumnType(metaInfo))
+		placeholders = append(placeholders, "?")
+	}
+	createTable := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", table, strings.Join(definitions, ", "))
+	if _, err := database.db.Exec(createTable); err != nil {
+		return nil, err
+	}
+	if err := database.verifyColumns(appName, names); err != nil {
+		return nil, err
+	}
+
+	for _, index := range database.config.Indexes[appName] {
+		indexColumns := make([]string, 0, len(index))
+		for _, indexColumn := range index {
+			if !findutils.ContainsString(names, indexColumn) {
+				return nil, fmt.Errorf("index column %s is not an output column of app %s", indexColumn, appName)
+			}
+			indexColumns = append(indexColumns, quoteIdentifier(indexColumn))
+		}
+		indexName := quoteIdentifier("idx_" + appName + "_" + strings.Join(index, "_"))
+		createIndex := fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s)", indexName, table, strings.Join(indexColumns, ", "))
+		if _, err := database.db.Exec(createIndex); err != nil {
+			return nil, err
+		}
+	}
+
+	quotedNames := make([]string, 0, len(names))
+	for _, name := range names {
+		quotedNames = append(quotedNames, quoteIdentifier(name))
+	}
+	insert := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, strings.Join(quotedNames, ", "), strings.Join(placeholders, ", "))
+	stmt, err := database.db.Prepare(insert)
+	if err != nil {
+		return nil, err
+	}
+	s := &sqliteSink{database: database, columns: columns, stmt: stmt}
+	database.sinks = append(database.sinks, s)
+	return s, nil
+}
+
+// verifyColumns verifies that the table of the app has all the output columns, an existing table appended by a run
+// with different output columns does not have them
+func (database *sqliteDatabase) verifyColumns(appName string, names []string) error {
+	rows, err := database.db.Query("SELECT name FROM pragma_table_info(?)", appName)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	tableColumns := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		tableColumns = append(tableColumns, name)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if !findutils.ContainsString(tableColumns, name) {
+			return fmt.Errorf("columns [%s] of existing table %s do not match the output columns [%s], use Mode %s "+
+				"to recreate the table", strings.Join(tableColumns, ","), appName, strings.Join(names, ","), gSqliteModeReplace)
+		}
+	}
+	return nil
+}
+
+// insert inserts the row using the statement in the current transaction, transaction is committed after BatchSize rows
+func (database *sqliteDatabase) insert(stmt *sql.Stmt, values []interface{}) error {
+	if database.tx == nil {
+		tx, err := database.db.Begin()
+		if err != nil {
+			return err
+		}
+		database.tx = tx
+		database.txStmts = make(map[*sql.Stmt]*sql.Stmt)
+	}
+	txStmt, exists := database.txStmts[stmt]
+	if !exists {
+		txStmt = database.tx.Stmt(stmt)
+		database.txStmts[stmt] = txStmt
+	}
+	if _, err := txStmt.Exec(values...); err != nil {
+		return err
+	}
+	database.pending++
+	if database.pending >= database.batchSize {
+		return database.commit()
+	}
+	return nil
+}
+
+// commit commits the rows inserted till now
+func (database *sqliteDatabase) commit() error {
+	if database.tx == nil {
+		return nil
+	}
+	// statements of the transaction are closed by the commit
+	err := database.tx.Commit()
+	database.tx = nil
+	database.txStmts = nil
+	database.pending = 0
+	return err
+}
+
+func (database *sqliteDatabase) close() error {
+	err := database.commit()
+	for _, s := range database.sinks {
+		s.stmt.Close()
+	}
+	if closeErr := database.db.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// sqliteSink inserts the records of an app in its table
+type sqliteSink struct {
+	database *sqliteDatabase
+	columns  []*filterlogs.MetaInfoType
+	stmt     *sql.Stmt
+}
+
+func (s *sqliteSink) write(record []*filterlogs.FilteredData) error {
+	values := make([]interface{}, len(record))
+	for i, filteredData := range record {
+		values[i] = sqliteValue(s.columns[i], filteredData)
+	}
+	return s.database.insert(s.stmt, values)
+}
+
+// sqliteValue converts the value of the element for its sqlite column, N/A and the typed values which cannot be parsed
+// are NULL
+func sqliteValue(metaInfo *filterlogs.MetaInfoType, filteredData *filterlogs.FilteredData) interface{} {
+	if filteredData == nil {
+		return nil
+	}
+	if len(metaInfo.Type) == 0 {
+		return filteredData.Text
+	}
+	switch value := filteredData.Value.(type) {
+	case int64, float64, bool:
+		return value
+	case *big.Rat:
+		f, _ := value.Float64()
+		return f
+	case time.Duration:
+		return int64(value)
+	case time.Time:
+		return value.Format("2006-01-02 15:04:05.999999999")
+	}
+	return nil
+}
+
+// flush commits the rows so that they are visible to the other readers of the database
+func (s *sqliteSink) flush() error {
+	return s.database.commit()
+}
+
+// close does nothing as the rows are committed when the database is closed
+func (s *sqliteSink) close() error {
+	return nil
+}
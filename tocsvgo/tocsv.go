@@ -1,10 +1,11 @@
 package tocsvgo
 
 import (
-	"encoding/csv"
 	"fmt"
-	"io"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 	"tocsv/filterlogs"
@@ -18,12 +19,14 @@ import (
 )
 
 const (
-	quit = "Quit"
+	quit    = "Quit"
+	appname = "tocsv"
 )
 
 type appDataType struct {
 	Header []*filterlogs.MetaInfoType
-	Data   [][]string
+	// joinData are the values of the Header of each record, used only if the app is used by a join
+	joinData [][]*filterlogs.FilteredData
 }
 
 // Tocsv stores an instance of tocsv
@@ -33,10 +36,25 @@ type Tocsv struct {
 	PrintOnStdout bool
 	Config        *TocsvConfig
 	OutputCsvMap  map[string]string
+
+	follow    bool
+	outputs   map[string]*output // key is the key of the output in OutputCsvMap
+	stdoutApp string             // app whose records are printed last on stdout
+	container container          // output of all the apps for the single file formats, opened with the first sink
+	template  *outputTemplate
+	runTime   time.Time
+
+	headers     map[string][]*filterlogs.MetaInfoType // key is AppName, columns of the apps given by the config
+	aggregators map[string]*aggregator                // key is the Name of the aggregation
+	pairers     map[string]*pairer                    // key is the Name of the pair
 }
 
 const (
-	gTagColumnName = "__tag__"
+	gTagColumnName     = "__tag__"
+	gFileColumnName    = "__file__"
+	gLineNoColumnName  = "__lineno__"
+	gOffsetColumnName  = "__offset__"
+	gLogLineColumnName = "__logline__"
 )
 
 // NewTocsv returns a new Tocsv instance
@@ -49,6 +67,71 @@ func NewTocsv(inputFiles []string, configFile string, anchorFiles []string, prin
 	if len(anchorFiles) == 0 && len(tocsvConfig.AnchorFiles) > 0 {
 		anchorFiles = tocsvConfig.AnchorFiles
 	}
+	if len(tocsvConfig.Format) == 0 {
+		tocsvConfig.Format = FormatCsv
+	}
+	if !isValidFormat(tocsvConfig.Format) {
+		fmt.Println("ERROR, unknown Format in config", tocsvConfig.Format, ", supported formats are", strings.Join(gFormats, ", "))
+		return nil
+	}
+	if printOnStdout && isFileOnlyFormat(tocsvConfig.Format) {
+		fmt.Println("ERROR, Format", tocsvConfig.Format, "cannot be printed on stdout")
+		return nil
+	}
+	if err := tocsvConfig.Parquet.verify(); err != nil {
+		fmt.Println("ERROR, invalid Parquet config,", err)
+		return nil
+	}
+	if err := tocsvConfig.Sqlite.verify(); err != nil {
+		fmt.Println("ERROR, invalid Sqlite config,", err)
+		return nil
+	}
+	template, err := tocsvConfig.verifyOutputFileConfig()
+	if err != nil {
+		fmt.Println("ERROR,", err)
+		return nil
+	}
+	if err = tocsvConfig.verifyJoins(); err != nil {
+		fmt.Println("ERROR, invalid Joins config,", err)
+		return nil
+	}
+	if err = tocsvConfig.verifyAggregations(); err != nil {
+		fmt.Println("ERROR, invalid Aggregations config,", err)
+		return nil
+	}
+	if err = tocsvConfig.verifyPairs(); err != nil {
+		fmt.Println("ERROR, invalid Pairs config,", err)
+		return nil
+	}
+
+	// config of the apps is read before the input so that the joins, aggregations and pairs are verified up front
+	logfilter := filterlogs.NewApp(inputFiles, configFile, anchorFiles, interactiveMode)
+	appsConfig := logfilter.LoadConfig()
+	if appsConfig == nil {
+		return nil
+	}
+	headers := map[string][]*filterlogs.MetaInfoType{}
+	tags := map[string][]string{}
+	for _, appconfig := range appsConfig.Apps {
+		headers[appconfig.AppName] = appconfig.ClientConfig.MetaInfo
+		for _, logline := range appconfig.LogLines {
+			tags[appconfig.AppName] = append(tags[appconfig.AppName], logline.Tag)
+		}
+	}
+	if err = tocsvConfig.verifyJoinColumns(headers); err != nil {
+		fmt.Println("ERROR, invalid Joins config,", err)
+		return nil
+	}
+	aggregators, err := tocsvConfig.newAggregators(headers)
+	if err != nil {
+		fmt.Println("ERROR, invalid Aggregations config,", err)
+		return nil
+	}
+	pairers, err := tocsvConfig.newPairers(headers, tags)
+	if err != nil {
+		fmt.Println("ERROR, invalid Pairs config,", err)
+		return nil
+	}
 
 	// create LogDirectory if it does not exist
 	if !printOnStdout {
@@ -66,22 +149,106 @@ func NewTocsv(inputFiles []string, configFile string, anchorFiles []string, prin
 
 	return &Tocsv{
 		AppData:       make(map[string]*appDataType),
-		Logfilter:     filterlogs.NewApp(inputFiles, configFile, anchorFiles, interactiveMode),
+		Logfilter:     logfilter,
 		PrintOnStdout: printOnStdout,
 		Config:        tocsvConfig,
 		OutputCsvMap:  make(map[string]string),
+		outputs:       make(map[string]*output),
+		template:      template,
+		runTime:       time.Now(),
+		headers:       headers,
+		aggregators:   aggregators,
+		pairers:       pairers,
 	}
 }
 
-// Run runs the tocsv and prints output as csv
+// SetFollowMode sets the follow mode, in this mode input files are followed as they grow and each record is flushed
+// to the output as soon as it is found
+func (a *Tocsv) SetFollowMode(follow bool) {
+	a.follow = follow
+	a.Logfilter.SetFollowMode(follow)
+}
+
+// SetTimeRange keeps only the records whose timestamp is in [since, until), it overrides Since and Until given in the
+// config
+func (a *Tocsv) SetTimeRange(since, until string) {
+	a.Logfilter.SetTimeRange(since, until)
+}
+
+// SetWhere keeps only the records for which the expression is true, it is applied along with the Where of the config
+func (a *Tocsv) SetWhere(where string) {
+	a.Logfilter.SetWhere(where)
+}
+
+// SetWhereKeepOtherApps keeps the records of the apps which do not have all the elements used in the expression of
+// SetWhere, by default their records are dropped
+func (a *Tocsv) SetWhereKeepOtherApps(keep bool) {
+	a.Logfilter.SetWhereKeepOtherApps(keep)
+}
+
+// Stop stops the processing of input files, Run returns after writing the records found till now
+func (a *Tocsv) Stop() {
+	a.Logfilter.Stop()
+}
+
+// SetFormat sets the output format, it overrides the Format given in the config. It returns false if the format is
+// not supported.
+func (a *Tocsv) SetFormat(format string) bool {
+	if !isValidFormat(format) {
+		fmt.Println("ERROR, unknown format", format, ", supported formats are", strings.Join(gFormats, ", "))
+		return false
+	}
+	if a.PrintOnStdout && isFileOnlyFormat(format) {
+		fmt.Println("ERROR, format", format, "cannot be printed on stdout")
+		return false
+	}
+	previousFormat := a.Config.Format
+	a.Config.Format = format
+	if _, err := a.Config.verifyOutputFileConfig(); err != nil {
+		fmt.Println("ERROR,", err)
+		a.Config.Format = previousFormat
+		return false
+	}
+	return true
+}
+
+// SetPrintLogLines adds the input file, line number, byte offset and the logline of each record in the output, it
+// overrides PrintLogLinesInOutput given in the config
+func (a *Tocsv) SetPrintLogLines(printLogLines bool) {
+	a.Config.PrintLogLinesInOutput = printLogLines
+}
+
+// SetOutputFile sets the output file of the formats which write all the apps in a single file, it overrides the
+// OutputFile given in the config
+func (a *Tocsv) SetOutputFile(fname string) {
+	a.Config.OutputFile = fname
+}
+
+// Run runs the tocsv and streams the output in the configured format. On stdout, records of all the apps are printed
+// as they arrive and the header of an app is printed whenever the records of another app are printed before it.
 func (a *Tocsv) Run() {
 	a.Logfilter.Run(a.callback)
-	a.writeCsv()
+	aborted := a.Logfilter.Err() != nil
+	if !aborted && !a.PrintOnStdout {
+		a.writeJoins()
+		a.writeAggregations()
+		a.writePairs()
+	}
+	a.closeOutputs()
+	if aborted {
+		fmt.Println("ERROR, output is incomplete as the processing is aborted,", a.Logfilter.Err())
+		return
+	}
+	if a.PrintOnStdout {
+		a.writeJoins()
+		a.writeAggregations()
+		a.writePairs()
+	}
 }
 
 // DisplayFetchedCsvs shows the fetch csv data using showcsv on terminal
 func (a *Tocsv) DisplayFetchedCsvs() {
-	if a.PrintOnStdout || len(a.OutputCsvMap) == 0 {
+	if a.PrintOnStdout || a.follow || a.Config.Format != FormatCsv || len(a.OutputCsvMap) == 0 {
 		return
 	}
 
@@ -123,75 +290,327 @@ func (a *Tocsv) callback(config *filterlogs.ClientConfigType, filteredDataMap ma
 		appData.Header = config.MetaInfo
 	}
 
-	// TODO, avoid this hand-crafting of a csv file. Use something like dataframe in golang. This is error prone
-	outputRecord := []string{}
+	outputRecord := []*filterlogs.FilteredData{}
 	// Add tag in outputRecord if PrintTagInOutput is true in config
 	if a.Config.PrintTagInOutput {
-		outputRecord = append(outputRecord, config.Tag)
+		outputRecord = append(outputRecord, &filterlogs.FilteredData{Text: config.Tag})
+	}
+	if a.Config.PrintSourceInOutput || a.Config.PrintLogLinesInOutput {
+		outputRecord = append(outputRecord,
+			&filterlogs.FilteredData{Text: config.Source},
+			&filterlogs.FilteredData{Text: strconv.Itoa(config.LineNo), Value: int64(config.LineNo)})
+	}
+	if a.Config.PrintLogLinesInOutput {
+		outputRecord = append(outputRecord,
+			&filterlogs.FilteredData{Text: strconv.FormatInt(config.Offset, 10), Value: config.Offset})
 	}
 
 	for _, metaInfo := range appData.Header {
-		eleKey := metaInfo.ElementKey
-		if filteredData, eleExists := filteredDataMap[eleKey]; eleExists {
-			if strings.Index(filteredData.Text, ",") > -1 {
-				outputRecord = append(outputRecord, "\""+filteredData.Text+"\"")
-			} else {
+		// nil is N/A
+		outputRecord = append(outputRecord, filteredDataMap[metaInfo.ElementKey])
+	}
+	values := outputRecord[len(outputRecord)-len(appData.Header):]
+	if a.Config.isJoinedApp(config.AppName) {
+		appData.joinData = append(appData.joinData, values)
+	}
+	a.aggregateRecord(config.AppName, values)
+	a.pairRecord(config.AppName, config.Tag, values)
+	if a.Config.PrintLogLinesInOutput {
+		outputRecord = append(outputRecord, &filterlogs.FilteredData{Text: config.LogLine})
+	}
+	a.streamRecord(config, appData, outputRecord)
+}
 
-				outputRecord = append(outputRecord, filteredData.Text)
-			}
-		} else {
-			outputRecord = append(outputRecord, "N/A")
+// columns returns the output columns of the app
+func (a *Tocsv) columns(appData *appDataType) []*filterlogs.MetaInfoType {
+	columns := []*filterlogs.MetaInfoType{}
+	if a.Config.PrintTagInOutput {
+		columns = append(columns, &filterlogs.MetaInfoType{ElementKey: gTagColumnName})
+	}
+	if a.Config.PrintSourceInOutput || a.Config.PrintLogLinesInOutput {
+		columns = append(columns,
+			&filterlogs.MetaInfoType{ElementKey: gFileColumnName},
+			&filterlogs.MetaInfoType{ElementKey: gLineNoColumnName, Type: filterlogs.TypeInt})
+	}
+	if a.Config.PrintLogLinesInOutput {
+		columns = append(columns, &filterlogs.MetaInfoType{ElementKey: gOffsetColumnName, Type: filterlogs.TypeInt})
+	}
+	columns = append(columns, appData.Header...)
+	if a.Config.PrintLogLinesInOutput {
+		// logline is the last column as it is the longest
+		columns = append(columns, &filterlogs.MetaInfoType{ElementKey: gLogLineColumnName})
+	}
+	return columns
+}
+
+// output is an output of an app, an app has multiple outputs if the OutputFileTemplate writes a separate file for each
+// tag or input file
+type output struct {
+	sink   sink
+	key    string // key in OutputCsvMap
+	fname  string // file being written, empty for stdout and the single file formats
+	fields outputFileFields
+
+	timestampIndex int // index of the timestamp column used for {first} and {last}, -1 if there is none
+}
+
+// recordTimestamp returns the timestamp of the record used for {first} and {last}, it is the first timestamp column
+func (o *output) recordTimestamp(record []*filterlogs.FilteredData) (time.Time, bool) {
+	if o.timestampIndex < 0 || record[o.timestampIndex] == nil {
+		return time.Time{}, false
+	}
+	timestamp, ok := record[o.timestampIndex].Value.(time.Time)
+	return timestamp, ok
+}
+
+// streamRecord writes the record to the output of the app, the output is opened when it is seen for the first time.
+// Records are flushed immediately in follow mode.
+func (a *Tocsv) streamRecord(config *filterlogs.ClientConfigType, appData *appDataType, record []*filterlogs.FilteredData) {
+	fields := outputFileFields{
+		app:   config.AppName,
+		tag:   config.Tag,
+		input: inputName(config.Source),
+		ext:   a.Config.Format,
+		run:   a.runTime,
+	}
+	key := config.AppName
+	if a.writesFilePerOutput() {
+		key = a.template.key(&fields)
+	}
+	o, exists := a.outputs[key]
+	if a.PrintOnStdout && a.stdoutApp != key {
+		// records of the previous app are printed before the header of this app
+		if previous, ok := a.outputs[a.stdoutApp]; ok && previous.sink != nil {
+			err := previous.sink.flush()
+			errorutils.PrintOnErr("ERROR while flushing output: "+previous.key, err)
 		}
+		a.stdoutApp = key
+		// output is opened again to print its header
+		exists = false
+	}
+	if !exists {
+		o = a.openOutput(key, fields, a.columns(appData))
+		// output without a sink is also stored so that opening of the output is not retried for every record
+		a.outputs[key] = o
 	}
-	appData.Data = append(appData.Data, outputRecord)
+	if o.sink == nil {
+		return
+	}
+	a.writeOutput(o, record)
 }
 
-func (a *Tocsv) writeCsv() {
+// writeOutput writes the record to the output and updates its {first} and {last} timestamps
+func (a *Tocsv) writeOutput(o *output, record []*filterlogs.FilteredData) {
+	err := o.sink.write(record)
+	if errorutils.PrintOnErr("ERROR while writing record to output: "+o.key, err) {
+		return
+	}
+	if timestamp, ok := o.recordTimestamp(record); ok {
+		if o.fields.first.IsZero() {
+			o.fields.first = timestamp
+		}
+		o.fields.last = timestamp
+	}
+	if a.follow {
+		err = o.sink.flush()
+		errorutils.PrintOnErr("ERROR while flushing output: "+o.key, err)
+	}
+}
 
-	for appName, appData := range a.AppData {
-		// create header
-		header := []string{}
-		if a.Config.PrintTagInOutput {
-			header = []string{gTagColumnName}
+// writesFilePerOutput returns true if the outputs are written in the files named by the OutputFileTemplate
+func (a *Tocsv) writesFilePerOutput() bool {
+	return !a.PrintOnStdout && !isSingleFileFormat(a.Config.Format)
+}
+
+func (a *Tocsv) openOutput(key string, fields outputFileFields, columns []*filterlogs.MetaInfoType) *output {
+	o := &output{key: key, fields: fields, timestampIndex: -1}
+	for i, metaInfo := range columns {
+		if metaInfo.Type == filterlogs.TypeTimestamp {
+			o.timestampIndex = i
+			break
 		}
-		for _, metaInfo := range appData.Header {
-			if len(metaInfo.ColumnName) > 0 {
-				header = append(header, metaInfo.ColumnName)
-			} else {
-				header = append(header, metaInfo.ElementKey)
-			}
+	}
+	appName := fields.app
+	if isSingleFileFormat(a.Config.Format) {
+		o.sink = a.openContainerSink(appName, columns)
+		return o
+	}
+	if a.PrintOnStdout {
+		appSink, err := newSink(a.Config, os.Stdout, nil, columns, true)
+		if errorutils.PrintOnErr("ERROR while writing header to output for app: "+appName, err) {
+			return o
 		}
+		o.sink = appSink
+		return o
+	}
 
-		if a.PrintOnStdout {
-			printAsCsv(appName, os.Stdout, header, appData.Data)
-		} else {
-			dt := time.Now().Format("20060201") // YYYYMMDD format
-			fname := fmt.Sprintf("%s/%s.%s.csv", a.Config.LogDirectory, appName, dt)
-			oFile, err := os.Create(fname)
-			if errorutils.PrintOnErr("ERROR while opening file for writing, "+fname, err) {
-				continue
+	fname, err := a.outputFileName(o)
+	if errorutils.PrintOnErr("ERROR while creating output file name for "+key, err) {
+		return o
+	}
+	err = os.MkdirAll(filepath.Dir(fname), 0755)
+	if errorutils.PrintOnErr("ERROR while creating directory of output file "+fname, err) {
+		return o
+	}
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	writeHeader := true
+	var columnIndex []int
+	if a.Config.OnOutputFileExists == gOnFileExistsAppend {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		// header is already present in a non empty file
+		if info, err := os.Stat(fname); err == nil && info.Size() > 0 {
+			writeHeader = false
+			if a.Config.Format == FormatCsv {
+				columnIndex, err = reconcileCsvHeader(fname, columnNames(columns), a.Config.OnHeaderMismatch)
+				if errorutils.PrintOnErr("ERROR while appending to output file "+fname, err) {
+					return o
+				}
 			}
-			defer oFile.Close()
-
-			printAsCsv(appName, oFile, header, appData.Data)
-			a.OutputCsvMap[appName] = fname
-			fmt.Println("Data fetched in", fname)
 		}
 	}
+	oFile, err := os.OpenFile(fname, flag, 0644)
+	if errorutils.PrintOnErr("ERROR while opening file for writing, "+fname, err) {
+		return o
+	}
+	appSink, err := newSink(a.Config, oFile, oFile, columns, writeHeader)
+	if errorutils.PrintOnErr("ERROR while writing header to output: "+key, err) {
+		oFile.Close()
+		return o
+	}
+	if columnIndex != nil {
+		appSink = &reorderSink{sink: appSink, columnIndex: columnIndex}
+	}
+	o.sink = appSink
+	o.fname = fname
+	a.OutputCsvMap[key] = fname
+	fmt.Println("Writing data in", fname)
+	return o
 }
 
-func printAsCsv(appName string, w io.Writer, header []string, data [][]string) {
-	writer := csv.NewWriter(w)
-	defer writer.Flush()
+// outputFileName returns the file to which the output is written. If the OutputFileTemplate uses {first} or {last}
+// then the output is written to a partial file which is renamed when the output is closed.
+func (a *Tocsv) outputFileName(o *output) (string, error) {
+	fname := a.template.expand(&o.fields)
+	if !filepath.IsAbs(fname) {
+		fname = a.Config.LogDirectory + "/" + fname
+	}
+	if a.template.uses(gPlaceholderFirst, gPlaceholderLast) {
+		fname += gPartialFileSuffix
+	} else if a.Config.OnOutputFileExists == gOnFileExistsUnique {
+		return uniqueFileName(fname), nil
+	}
+	// two outputs of the same run cannot write to the same file
+	for _, other := range a.outputs {
+		if other.fname == fname {
+			return "", fmt.Errorf("OutputFileTemplate gives the same file %s for %s and %s", fname, other.key, o.key)
+		}
+	}
+	return fname, nil
+}
 
-	err := writer.Write(header)
-	if errorutils.PrintOnErr("ERROR while writing header to output for app: "+appName, err) {
+// closeOutput closes the sink of the output, the partial file is renamed once the {first} and {last} timestamps are
+// known
+func (a *Tocsv) closeOutput(o *output) {
+	err := o.sink.close()
+	if errorutils.PrintOnErr("ERROR while closing output: "+o.key, err) {
+		return
+	}
+	if !strings.HasSuffix(o.fname, gPartialFileSuffix) {
 		return
 	}
-	for _, record := range data {
-		err = writer.Write(record)
-		if errorutils.PrintOnErr("ERROR while writing record to output for app: "+appName, err) {
-			continue
+	fname := a.template.expand(&o.fields)
+	if !filepath.IsAbs(fname) {
+		fname = a.Config.LogDirectory + "/" + fname
+	}
+	if a.Config.OnOutputFileExists == gOnFileExistsUnique {
+		fname = uniqueFileName(fname)
+	}
+	err = os.Rename(o.fname, fname)
+	if errorutils.PrintOnErr("ERROR while renaming output file "+o.fname, err) {
+		return
+	}
+	o.fname = fname
+	a.OutputCsvMap[o.key] = fname
+	fmt.Println("Renamed", o.key, "output to", fname)
+}
+
+// openContainerSink returns the sink of the app from the container, container is opened for the first app
+func (a *Tocsv) openContainerSink(appName string, columns []*filterlogs.MetaInfoType) sink {
+	fname := a.singleOutputFileName()
+	if a.container == nil {
+		var err error
+		a.container, err = newContainer(a.Config, fname)
+		if errorutils.PrintOnErr("ERROR while opening file for writing, "+fname, err) {
+			return nil
 		}
+		fmt.Println("Writing data in", fname)
+	}
+	appSink, err := a.container.newSink(appName, columns)
+	if errorutils.PrintOnErr("ERROR while creating output for app: "+appName, err) {
+		return nil
+	}
+	a.OutputCsvMap[appName] = fname
+	return appSink
+}
+
+// singleOutputFileName returns the OutputFile, default is tocsv.<YYYYMMDD>.<Format> in LogDirectory
+func (a *Tocsv) singleOutputFileName() string {
+	if len(a.Config.OutputFile) > 0 {
+		fname, _ := tilde.Expand(a.Config.OutputFile)
+		return fname
+	}
+	return fmt.Sprintf("%s/%s.%s.%s", a.Config.LogDirectory, appname, a.runTime.Format(gRunLayout), a.Config.Format)
+}
+
+func (a *Tocsv) closeOutputs() {
+	keys := make([]string, 0, len(a.outputs))
+	for key := range a.outputs {
+		keys = append(keys, key)
+	}
+	// outputs are closed in order so that the unique suffixes of the renamed files are deterministic
+	sort.Strings(keys)
+	for _, key := range keys {
+		if o := a.outputs[key]; o.sink != nil {
+			a.closeOutput(o)
+		}
+	}
+	if a.container != nil {
+		err := a.container.close()
+		errorutils.PrintOnErr("ERROR while closing output file "+a.singleOutputFileName(), err)
+	}
+}
+
+// writeTable writes the records of a join, an aggregation or a pair in its output after reading all the input, on stdout
+// they are printed after the apps
+func (a *Tocsv) writeTable(name string, columns []*filterlogs.MetaInfoType, records [][]*filterlogs.FilteredData) {
+	if a.PrintOnStdout {
+		tableSink, err := newSink(a.Config, os.Stdout, nil, columns, true)
+		if errorutils.PrintOnErr("ERROR while writing header to output for: "+name, err) {
+			return
+		}
+		for _, record := range records {
+			err = tableSink.write(record)
+			errorutils.PrintOnErr("ERROR while writing record to output for: "+name, err)
+		}
+		err = tableSink.close()
+		errorutils.PrintOnErr("ERROR while writing output for: "+name, err)
+		return
+	}
+	fields := outputFileFields{app: name, ext: a.Config.Format, run: a.runTime}
+	key := name
+	if a.writesFilePerOutput() {
+		key = a.template.key(&fields)
+	}
+	if _, exists := a.outputs[key]; exists {
+		fmt.Println("ERROR, output of", name, "is already used by an app")
+		return
+	}
+	o := a.openOutput(key, fields, columns)
+	a.outputs[key] = o
+	if o.sink == nil {
+		return
+	}
+	for _, record := range records {
+		a.writeOutput(o, record)
 	}
 }
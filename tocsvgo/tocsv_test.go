@@ -1,9 +1,13 @@
 package tocsvgo_test
 
 import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 	"time"
 	"tocsv/tocsvgo"
@@ -12,6 +16,9 @@ import (
 	"github.com/parmaanu/goutils/fileutils"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xuri/excelize/v2"
 	tilde "gopkg.in/mattes/go-expand-tilde.v1"
 )
 
@@ -118,7 +125,7 @@ Apps:
 	assert.NotNil(t, tocsv, "not able to create tocsv instance")
 	tocsv.Run()
 
-	dt := time.Now().Format("20060201") // YYYYMMDD format
+	dt := time.Now().Format("20060102") // YYYYMMDD format
 	outputFileName, err := tilde.Expand(fmt.Sprintf("~/logs/Orders.%s.csv", dt))
 	assert.NoError(t, err, "error found while expanding full path")
 	assert.FileExists(t, outputFileName, "file does not exits")
@@ -153,7 +160,7 @@ Apps:
 	assert.NotNil(t, tocsv, "not able to create tocsv instance")
 	tocsv.Run()
 
-	dt := time.Now().Format("20060201") // YYYYMMDD format
+	dt := time.Now().Format("20060102") // YYYYMMDD format
 	outputFileName, err := tilde.Expand(fmt.Sprintf("./Orders.%s.csv", dt))
 	assert.NoError(t, err, "error found while expanding full path")
 	assert.FileExists(t, outputFileName, "file does not exits")
@@ -232,3 +239,1017 @@ Apps:
 2020-07-12 01:54:23.124127,154,-1230,1240,2470` + "\n"
 	assert.Equal(t, expectedOutput, output)
 }
+
+func Test_records_of_multiple_apps_on_stdout_are_printed_with_the_header_of_their_app(t *testing.T) {
+	captureStdout()
+
+	fname := "test.log"
+	gMfs.SetFileData(fname, []string{
+		"2020-06-02 14:33:56.531063 ORDER NEW price: 123.123, quantity: 1000, securityId: 999, side: BUY, bid: 124.0, ask: 125.0",
+		"2020-07-12 01:54:23.124127 POSITION securityId: 154, netPosition: -1230, startOfDayPosition: 1240, dayTradedVolume: 2470",
+		"2020-06-02 14:33:57.000000 ORDER NEW price: 99.5, quantity: 10, securityId: 154, side: SELL, bid: 99.0, ask: 100.0",
+	})
+	configFile := "tocsv.yaml"
+	gMfs.SetFileData(configFile, []string{`
+Apps:
+- *Orders
+- *Position
+`})
+	anchorFiles := []string{"orders.yaml", "position.yaml", "columns.yaml"}
+	for _, f := range anchorFiles {
+		gMfs.SetFileData(f, []string{})
+	}
+
+	tocsv := tocsvgo.NewTocsv([]string{fname}, configFile, anchorFiles, true, false)
+	assert.NotNil(t, tocsv, "not able to create tocsv instance")
+	tocsv.Run()
+
+	output := getCapturedStdout()
+	// records are printed as they arrive, header of an app is printed again after the records of another app
+	expectedOutput := `timestamp,securityId,price,quantity,side,bid,ask
+2020-06-02 14:33:56.531063,999,123.123,1000,BUY,124.0,125.0
+timestamp,securityId,netPosition,sodPosition,dayTradedVolume
+2020-07-12 01:54:23.124127,154,-1230,1240,2470
+timestamp,securityId,price,quantity,side,bid,ask
+2020-06-02 14:33:57.000000,154,99.5,10,SELL,99.0,100.0
+`
+	assert.Equal(t, expectedOutput, output)
+}
+
+func Test_jsonl_format_writes_a_json_object_for_each_record(t *testing.T) {
+	captureStdout()
+
+	fname := "jsonl.log"
+	gMfs.SetFileData(fname, []string{
+		"ORDER NEW price: 123.10, quantity: 1000, side: BUY",
+		"ORDER NEW price: 99.5, quantity: 10, venue: X",
+		"ORDER NEW price: .5, quantity: 20, ratio: NaN, side: SELL",
+		"ORDER NEW price: 1/3, quantity: 30, ratio: 1.5, side: BUY",
+	})
+	configFile := "jsonl_tocsv.yaml"
+	gMfs.SetFileData(configFile, strings.Split(`
+Format: jsonl
+PrintTagInOutput: true
+PrintSourceInOutput: true
+Apps:
+    - AppName: Orders
+      LogLines:
+          - Tag: NEW
+            Patterns: ['ORDER NEW']
+            ExampleLine: 'ORDER NEW price: 123.10, quantity: 1000, ratio: 1.5, side: BUY'
+            Elements:
+                PriceKey:    {ColumnName: price, StartPattern: 'price: ', EndPattern: ',', Type: decimal}
+                QuantityKey: {ColumnName: quantity, StartPattern: 'quantity: ', EndPattern: ',', Type: int}
+                RatioKey:    {ColumnName: ratio, StartPattern: 'ratio: ', EndPattern: ',', Type: float}
+                SideKey:     {StartPattern: 'side: ', EndPattern: '$'}
+`, "\n"))
+
+	tocsv := tocsvgo.NewTocsv([]string{fname}, configFile, []string{}, true, false)
+	if !assert.NotNil(t, tocsv, "not able to create tocsv instance") {
+		getCapturedStdout()
+		return
+	}
+	tocsv.Run()
+
+	output := getCapturedStdout()
+	// decimals which are not valid json numbers are written as their exact digits or as strings, NaN is null
+	expectedOutput := `{"__tag__":"NEW","__file__":"jsonl.log","__lineno__":1,"price":123.10,"quantity":1000,"ratio":null,"SideKey":"BUY"}
+{"__tag__":"NEW","__file__":"jsonl.log","__lineno__":2,"price":99.5,"quantity":10,"ratio":null,"SideKey":null}
+{"__tag__":"NEW","__file__":"jsonl.log","__lineno__":3,"price":0.5,"quantity":20,"ratio":null,"SideKey":"SELL"}
+{"__tag__":"NEW","__file__":"jsonl.log","__lineno__":4,"price":"1/3","quantity":30,"ratio":1.5,"SideKey":"BUY"}
+`
+	assert.Equal(t, expectedOutput, output)
+}
+
+func Test_unknown_format_is_rejected(t *testing.T) {
+	configFile := "format_tocsv.yaml"
+	gMfs.SetFileData(configFile, []string{"Format: xml"})
+
+	captureStdout()
+	tocsv := tocsvgo.NewTocsv([]string{"test.log"}, configFile, []string{}, true, false)
+	output := getCapturedStdout()
+	assert.Nil(t, tocsv)
+	assert.Contains(t, output, "unknown Format in config xml")
+}
+
+func Test_parquet_format_writes_typed_columns(t *testing.T) {
+	logDirectory, err := ioutil.TempDir("", "tocsv_parquet")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(logDirectory)
+
+	fname := "parquet.log"
+	gMfs.SetFileData(fname, []string{
+		"2020-06-02 14:33:56.531063 ORDER NEW price: 123.5, quantity: 1000, side: BUY",
+		"2020-06-02 14:33:57.000000 ORDER NEW price: 9x.5, quantity: 10, venue: X",
+	})
+	configFile := "parquet_tocsv.yaml"
+	gMfs.SetFileData(configFile, strings.Split(`
+Format: parquet
+LogDirectory: `+logDirectory+`
+Parquet:
+    RowGroupSize: 1
+    Compression: zstd
+Apps:
+    - AppName: Orders
+      LogLines:
+          - Tag: NEW
+            Patterns: ['ORDER NEW']
+            ExampleLine: '2020-06-02 14:33:56.531063 ORDER NEW price: 123.5, quantity: 1000, side: BUY'
+            Elements:
+                TimeStampKey: {ColumnName: timestamp, StartPattern: '^', PatternLength: 26, Type: timestamp, Layout: '2006-01-02 15:04:05.000000'}
+                PriceKey:     {ColumnName: price, StartPattern: 'price: ', EndPattern: ',', Type: float}
+                QuantityKey:  {ColumnName: quantity, StartPattern: 'quantity: ', EndPattern: ',', Type: int}
+                SideKey:      {ColumnName: side, StartPattern: 'side: ', EndPattern: '$'}
+`, "\n"))
+
+	captureStdout()
+	tocsv := tocsvgo.NewTocsv([]string{fname}, configFile, []string{}, false, false)
+	if tocsv != nil {
+		tocsv.Run()
+	}
+	getCapturedStdout()
+	if !assert.NotNil(t, tocsv, "not able to create tocsv instance") {
+		return
+	}
+
+	outputFileName := tocsv.OutputCsvMap["Orders"]
+	assert.True(t, strings.HasSuffix(outputFileName, ".parquet"), outputFileName)
+	fr, err := local.NewLocalFileReader(outputFileName)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer fr.Close()
+	pr, err := reader.NewParquetReader(fr, nil, 1)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer pr.ReadStop()
+	assert.Equal(t, int64(2), pr.GetNumRows())
+	rows, err := pr.ReadByNumber(2)
+	if !assert.NoError(t, err) {
+		return
+	}
+	output, _ := json.Marshal(rows)
+	ts := time.Date(2020, 6, 2, 14, 33, 56, 531063000, time.UTC).UnixNano() / 1000
+	expectedOutput := fmt.Sprintf(`[{"Timestamp":%d,"Price":123.5,"Quantity":1000,"Side":"BUY"},`+
+		`{"Timestamp":%d,"Price":null,"Quantity":10,"Side":null}]`, ts, ts+468937)
+	assert.Equal(t, expectedOutput, string(output))
+}
+
+func Test_parquet_format_cannot_be_printed_on_stdout(t *testing.T) {
+	configFile := "parquet_stdout_tocsv.yaml"
+	gMfs.SetFileData(configFile, []string{"Format: parquet"})
+
+	captureStdout()
+	tocsv := tocsvgo.NewTocsv([]string{"test.log"}, configFile, []string{}, true, false)
+	output := getCapturedStdout()
+	assert.Nil(t, tocsv)
+	assert.Contains(t, output, "Format parquet cannot be printed on stdout")
+}
+
+func runSqliteTocsv(t *testing.T, outputFile, mode string) string {
+	fname := "sqlite.log"
+	gMfs.SetFileData(fname, []string{
+		"2020-06-02 14:33:56.531063 ORDER NEW price: 123.5, quantity: 1000, securityId: 999",
+		"2020-07-12 01:54:23.124127 POSITION securityId: 154, netPosition: -1230",
+		"2020-06-02 14:33:57.000000 ORDER NEW price: 99.5, quantity: 10, securityId: 154",
+	})
+	configFile := "sqlite_tocsv.yaml"
+	gMfs.SetFileData(configFile, strings.Split(`
+Format: sqlite
+Sqlite:
+    Mode: `+mode+`
+    BatchSize: 2
+    Indexes:
+        Orders: [[securityId], [securityId, timestamp]]
+Apps:
+    - AppName: Orders
+      LogLines:
+          - Tag: NEW
+            Patterns: ['ORDER NEW']
+            ExampleLine: '2020-06-02 14:33:56.531063 ORDER NEW price: 123.5, quantity: 1000, securityId: 999'
+            Elements:
+                TimeStampKey:  {ColumnName: timestamp, StartPattern: '^', PatternLength: 26, Type: timestamp, Layout: '2006-01-02 15:04:05.000000'}
+                PriceKey:      {ColumnName: price, StartPattern: 'price: ', EndPattern: ',', Type: decimal}
+                QuantityKey:   {ColumnName: quantity, StartPattern: 'quantity: ', EndPattern: ',', Type: int}
+                SecurityIdKey: {ColumnName: securityId, StartPattern: 'securityId: ', EndPattern: '$'}
+    - AppName: Position
+      LogLines:
+          - Tag: POSITION
+            Patterns: ['POSITION']
+            ExampleLine: '2020-07-12 01:54:23.124127 POSITION securityId: 154, netPosition: -1230'
+            Elements:
+                SecurityIdKey:  {ColumnName: securityId, StartPattern: 'securityId: ', EndPattern: ','}
+                NetPositionKey: {ColumnName: netPosition, StartPattern: 'netPosition: ', EndPattern: '$', Type: int}
+`, "\n"))
+
+	captureStdout()
+	tocsv := tocsvgo.NewTocsv([]string{fname}, configFile, []string{}, false, false)
+	if tocsv != nil {
+		tocsv.SetOutputFile(outputFile)
+		tocsv.Run()
+	}
+	output := getCapturedStdout()
+	assert.NotNil(t, tocsv, "not able to create tocsv instance")
+	return output
+}
+
+func Test_sqlite_format_writes_a_table_for_each_app(t *testing.T) {
+	logDirectory, err := ioutil.TempDir("", "tocsv_sqlite")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(logDirectory)
+	outputFile := logDirectory + "/results.db"
+
+	query := func(query string) []string {
+		db, err := sql.Open("sqlite3", outputFile)
+		if !assert.NoError(t, err) {
+			return nil
+		}
+		defer db.Close()
+		rows, err := db.Query(query)
+		if !assert.NoError(t, err) {
+			return nil
+		}
+		defer rows.Close()
+		result := []string{}
+		for rows.Next() {
+			var row string
+			assert.NoError(t, rows.Scan(&row))
+			result = append(result, row)
+		}
+		return result
+	}
+
+	runSqliteTocsv(t, outputFile, "replace")
+	assert.Equal(t, []string{
+		"2020-06-02 14:33:56.531063|123.5|1000|999",
+		"2020-06-02 14:33:57|99.5|10|154",
+	}, query(`SELECT timestamp || '|' || price || '|' || quantity || '|' || securityId FROM Orders ORDER BY rowid`))
+	assert.Equal(t, []string{"154|-1230"}, query(`SELECT securityId || '|' || netPosition FROM Position`))
+	assert.Equal(t, []string{`idx_Orders_securityId`, `idx_Orders_securityId_timestamp`},
+		query(`SELECT name FROM sqlite_master WHERE type = 'index' AND tbl_name = 'Orders' ORDER BY name`))
+	assert.Equal(t, []string{"1010"}, query(`SELECT CAST(SUM(quantity) AS TEXT) FROM Orders`))
+
+	runSqliteTocsv(t, outputFile, "append")
+	assert.Equal(t, []string{"4"}, query(`SELECT CAST(COUNT(*) AS TEXT) FROM Orders`))
+
+	runSqliteTocsv(t, outputFile, "replace")
+	assert.Equal(t, []string{"2"}, query(`SELECT CAST(COUNT(*) AS TEXT) FROM Orders`))
+
+	// table of a different schema is not appended
+	query(`DROP TABLE Position`)
+	query(`CREATE TABLE Position (securityId TEXT, position INTEGER)`)
+	output := runSqliteTocsv(t, outputFile, "append")
+	assert.Contains(t, output, "columns [securityId,position] of existing table Position do not match the output columns [securityId,netPosition], use Mode replace to recreate the table")
+	assert.Equal(t, 1, strings.Count(output, "existing table Position"))
+	assert.Equal(t, []string{"4"}, query(`SELECT CAST(COUNT(*) AS TEXT) FROM Orders`))
+}
+
+func Test_xlsx_format_writes_a_sheet_for_each_app(t *testing.T) {
+	fname := "xlsx.log"
+	gMfs.SetFileData(fname, []string{
+		"2020-06-02 14:33:56.531063 ORDER NEW price: 123.5, quantity: 1000, securityId: 999",
+		"2020-07-12 01:54:23.124127 POSITION securityId: 154, netPosition: -1230",
+		"2020-06-02 14:33:57.640063 ORDER NEW price: 99.5, quantity: 10, securityId: ABC",
+	})
+	logDirectory, err := ioutil.TempDir("", "tocsv_xlsx")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(logDirectory)
+	outputFile := logDirectory + "/results.xlsx"
+
+	configFile := "xlsx_tocsv.yaml"
+	gMfs.SetFileData(configFile, strings.Split(`
+Format: xlsx
+OutputFile: `+outputFile+`
+Apps:
+    - AppName: Orders
+      LogLines:
+          - Tag: NEW
+            Patterns: ['ORDER NEW']
+            ExampleLine: '2020-06-02 14:33:56.531063 ORDER NEW price: 123.5, quantity: 1000, securityId: 999'
+            Elements:
+                TimeStampKey:  {ColumnName: timestamp, StartPattern: '^', PatternLength: 26, Type: timestamp, Layout: '2006-01-02 15:04:05.000000'}
+                PriceKey:      {ColumnName: price, StartPattern: 'price: ', EndPattern: ',', Type: decimal}
+                QuantityKey:   {ColumnName: quantity, StartPattern: 'quantity: ', EndPattern: ','}
+                SecurityIdKey: {ColumnName: securityId, StartPattern: 'securityId: ', EndPattern: '$'}
+    - AppName: Position
+      LogLines:
+          - Tag: POSITION
+            Patterns: ['POSITION']
+            ExampleLine: '2020-07-12 01:54:23.124127 POSITION securityId: 154, netPosition: -1230'
+            Elements:
+                SecurityIdKey:  {ColumnName: securityId, StartPattern: 'securityId: ', EndPattern: ','}
+                NetPositionKey: {ColumnName: netPosition, StartPattern: 'netPosition: ', EndPattern: '$', Type: int}
+`, "\n"))
+
+	captureStdout()
+	tocsv := tocsvgo.NewTocsv([]string{fname}, configFile, []string{}, false, false)
+	if tocsv != nil {
+		tocsv.Run()
+	}
+	getCapturedStdout()
+	if !assert.NotNil(t, tocsv, "not able to create tocsv instance") {
+		return
+	}
+	assert.Equal(t, map[string]string{"Orders": outputFile, "Position": outputFile}, tocsv.OutputCsvMap)
+
+	workbook, err := excelize.OpenFile(outputFile)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"Orders", "Position"}, workbook.GetSheetList())
+
+	rows, err := workbook.GetRows("Orders")
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"timestamp", "price", "quantity", "securityId"},
+		{"2020-06-02 14:33:56.531", "123.5", "1000", "999"},
+		{"2020-06-02 14:33:57.640", "99.5", "10", "ABC"},
+	}, rows)
+	rows, err = workbook.GetRows("Position")
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"securityId", "netPosition"}, {"154", "-1230"}}, rows)
+
+	autoFilters := []string{}
+	for _, definedName := range workbook.GetDefinedName() {
+		if definedName.Name == "_xlnm._FilterDatabase" {
+			autoFilters = append(autoFilters, definedName.RefersTo)
+		}
+	}
+	assert.ElementsMatch(t, []string{"Orders!$A$1:$D$3", "Position!$A$1:$B$2"}, autoFilters)
+
+	// values are numeric cells unless they cannot be parsed as numbers
+	sheet, err := readZipEntry(outputFile, "xl/worksheets/sheet1.xml")
+	assert.NoError(t, err)
+	assert.Contains(t, sheet, `<c r="C2"><v>1000</v></c>`)
+	assert.Contains(t, sheet, `<c r="D3" t="str"><v>ABC</v></c>`)
+	assert.Contains(t, sheet, `<pane activePane="bottomLeft" state="frozen" topLeftCell="A2" ySplit="1"></pane>`)
+}
+
+func readZipEntry(fname, entry string) (string, error) {
+	zipReader, err := zip.OpenReader(fname)
+	if err != nil {
+		return "", err
+	}
+	defer zipReader.Close()
+	for _, file := range zipReader.File {
+		if file.Name != entry {
+			continue
+		}
+		reader, err := file.Open()
+		if err != nil {
+			return "", err
+		}
+		defer reader.Close()
+		data, err := ioutil.ReadAll(reader)
+		return string(data), err
+	}
+	return "", fmt.Errorf("%s not found in %s", entry, fname)
+}
+
+func runTemplateTocsv(t *testing.T, logDirectory, template, outputFileConfig string) *tocsvgo.Tocsv {
+	gMfs.SetFileData("template1.log", []string{
+		"2020-06-02 14:33:56.531063 ORDER NEW price: 123.5, quantity: 1000",
+		"2020-06-02 14:35:00.000000 ORDER CANCEL price: 123.5, quantity: 1000",
+	})
+	gMfs.SetFileData("template2.log", []string{
+		"2020-06-02 15:00:00.000000 ORDER NEW price: 99.5, quantity: 10",
+	})
+	configFile := "template_tocsv.yaml"
+	gMfs.SetFileData(configFile, strings.Split(`
+LogDirectory: `+logDirectory+`
+OutputFileTemplate: '`+template+`'
+`+outputFileConfig+`
+Apps:
+    - AppName: Orders
+      LogLines:
+          - Tag: NEW
+            Patterns: ['ORDER NEW']
+            ExampleLine: '2020-06-02 14:33:56.531063 ORDER NEW price: 123.5, quantity: 1000'
+            Elements: &Elements
+                TimeStampKey: {ColumnName: timestamp, StartPattern: '^', PatternLength: 26, Type: timestamp, Layout: '2006-01-02 15:04:05.000000'}
+                PriceKey:     {ColumnName: price, StartPattern: 'price: ', EndPattern: ','}
+          - Tag: CANCEL
+            Patterns: ['ORDER CANCEL']
+            ExampleLine: '2020-06-02 14:35:00.000000 ORDER CANCEL price: 123.5, quantity: 1000'
+            Elements: *Elements
+`, "\n"))
+
+	captureStdout()
+	tocsv := tocsvgo.NewTocsv([]string{"template1.log", "template2.log"}, configFile, []string{}, false, false)
+	if tocsv != nil {
+		tocsv.Run()
+	}
+	getCapturedStdout()
+	return tocsv
+}
+
+func Test_OutputFileTemplate_writes_a_file_for_each_tag_and_input(t *testing.T) {
+	logDirectory, err := ioutil.TempDir("", "tocsv_template")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(logDirectory)
+
+	tocsv := runTemplateTocsv(t, logDirectory, "{run:2006}/{app}_{tag}_{input}.{ext}", "")
+	if !assert.NotNil(t, tocsv, "not able to create tocsv instance") {
+		return
+	}
+	year := time.Now().Format("2006")
+	assert.Equal(t, map[string]string{
+		"Orders/NEW/template1.log":    logDirectory + "/" + year + "/Orders_NEW_template1.log.csv",
+		"Orders/CANCEL/template1.log": logDirectory + "/" + year + "/Orders_CANCEL_template1.log.csv",
+		"Orders/NEW/template2.log":    logDirectory + "/" + year + "/Orders_NEW_template2.log.csv",
+	}, tocsv.OutputCsvMap)
+	assert.Equal(t, "timestamp,price\n2020-06-02 15:00:00.000000,99.5\n",
+		string(fileutils.ReadFullFileAsBytes(tocsv.OutputCsvMap["Orders/NEW/template2.log"])))
+}
+
+func Test_OutputFileTemplate_renames_the_file_with_first_and_last_timestamps(t *testing.T) {
+	logDirectory, err := ioutil.TempDir("", "tocsv_template")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(logDirectory)
+
+	tocsv := runTemplateTocsv(t, logDirectory, "{app}.{first}-{last:150405}.{ext}", "OnOutputFileExists: unique")
+	if !assert.NotNil(t, tocsv, "not able to create tocsv instance") {
+		return
+	}
+	expectedFile := logDirectory + "/Orders.20200602T143356-150000.csv"
+	assert.Equal(t, map[string]string{"Orders": expectedFile}, tocsv.OutputCsvMap)
+	assert.Equal(t, `timestamp,price
+2020-06-02 14:33:56.531063,123.5
+2020-06-02 14:35:00.000000,123.5
+2020-06-02 15:00:00.000000,99.5
+`, string(fileutils.ReadFullFileAsBytes(expectedFile)))
+
+	// file of the previous run is not overwritten
+	tocsv = runTemplateTocsv(t, logDirectory, "{app}.{first}-{last:150405}.{ext}", "OnOutputFileExists: unique")
+	if !assert.NotNil(t, tocsv, "not able to create tocsv instance") {
+		return
+	}
+	assert.Equal(t, map[string]string{"Orders": logDirectory + "/Orders.20200602T143356-150000.1.csv"}, tocsv.OutputCsvMap)
+	files, _ := ioutil.ReadDir(logDirectory)
+	assert.Equal(t, 2, len(files))
+}
+
+func Test_OnOutputFileExists_append_writes_the_header_once(t *testing.T) {
+	logDirectory, err := ioutil.TempDir("", "tocsv_template")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(logDirectory)
+
+	for i := 0; i < 2; i++ {
+		tocsv := runTemplateTocsv(t, logDirectory, "{app}_{tag}.{ext}", "OnOutputFileExists: append")
+		if !assert.NotNil(t, tocsv, "not able to create tocsv instance") {
+			return
+		}
+	}
+	assert.Equal(t, `timestamp,price
+2020-06-02 14:35:00.000000,123.5
+2020-06-02 14:35:00.000000,123.5
+`, string(fileutils.ReadFullFileAsBytes(logDirectory+"/Orders_CANCEL.csv")))
+}
+
+func Test_invalid_OutputFileTemplate_is_rejected(t *testing.T) {
+	for template, expectedError := range map[string]string{
+		"{app}.{date}.csv":           "unknown placeholder {date}",
+		"{app}.{run.csv":             "placeholder is not closed",
+		"{app:2006}.csv":             "layout can only be given for first, last, run placeholders",
+		"{app}.{first}.{last}.{ext}": "OnOutputFileExists append cannot be used with {first} or {last}",
+	} {
+		configFile := "invalid_template_tocsv.yaml"
+		gMfs.SetFileData(configFile, []string{"OutputFileTemplate: '" + template + "'", "OnOutputFileExists: append"})
+
+		captureStdout()
+		tocsv := tocsvgo.NewTocsv([]string{"test.log"}, configFile, []string{}, false, false)
+		output := getCapturedStdout()
+		assert.Nil(t, tocsv, template)
+		assert.Contains(t, output, expectedError, template)
+	}
+}
+
+func Test_OnHeaderMismatch_strict_refuses_to_append_to_a_file_with_a_different_header(t *testing.T) {
+	logDirectory, err := ioutil.TempDir("", "tocsv_append")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(logDirectory)
+	existingData := "timestamp,securityId\n2020-06-02 14:00:00.000000,154\n"
+	assert.NoError(t, ioutil.WriteFile(logDirectory+"/Orders_CANCEL.csv", []byte(existingData), 0644))
+
+	tocsv := runTemplateTocsv(t, logDirectory, "{app}_{tag}.{ext}", "OnOutputFileExists: append")
+	if !assert.NotNil(t, tocsv, "not able to create tocsv instance") {
+		return
+	}
+	assert.NotContains(t, tocsv.OutputCsvMap, "Orders/CANCEL")
+	assert.Equal(t, existingData, string(fileutils.ReadFullFileAsBytes(logDirectory+"/Orders_CANCEL.csv")))
+}
+
+func Test_OnHeaderMismatch_reconcile_adds_the_new_columns_to_the_existing_file(t *testing.T) {
+	logDirectory, err := ioutil.TempDir("", "tocsv_append")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(logDirectory)
+	assert.NoError(t, ioutil.WriteFile(logDirectory+"/Orders_CANCEL.csv",
+		[]byte("timestamp,securityId\n2020-06-02 14:00:00.000000,154\n"), 0644))
+
+	tocsv := runTemplateTocsv(t, logDirectory, "{app}_{tag}.{ext}", "OnOutputFileExists: append\nOnHeaderMismatch: reconcile")
+	if !assert.NotNil(t, tocsv, "not able to create tocsv instance") {
+		return
+	}
+	assert.Equal(t, `timestamp,securityId,price
+2020-06-02 14:00:00.000000,154,N/A
+2020-06-02 14:35:00.000000,N/A,123.5
+`, string(fileutils.ReadFullFileAsBytes(logDirectory+"/Orders_CANCEL.csv")))
+}
+
+func Test_SetPrintLogLines_adds_the_logline_and_its_location_in_output(t *testing.T) {
+	captureStdout()
+
+	gMfs.SetFileData("loglines1.log", []string{
+		"2020-06-02 14:33:56.531063 ORDER NEW price: 123.5, quantity: 1000",
+		"2020-06-02 14:34:00.000000 heartbeat",
+		"2020-06-02 14:35:00.000000 ORDER NEW price: 99.5, quantity: 10",
+	})
+	gMfs.SetFileData("loglines2.log", []string{
+		"2020-06-02 14:34:30.000000 ORDER NEW price: 1,5, quantity: 5",
+	})
+	configFile := "loglines_tocsv.yaml"
+	gMfs.SetFileData(configFile, strings.Split(`
+Apps:
+    - AppName: Orders
+      LogLines:
+          - Tag: NEW
+            Patterns: ['ORDER NEW']
+            ExampleLine: '2020-06-02 14:33:56.531063 ORDER NEW price: 123.5, quantity: 1000'
+            Elements:
+                PriceKey: {ColumnName: price, StartPattern: 'price: ', EndPattern: ', quantity'}
+`, "\n"))
+
+	tocsv := tocsvgo.NewTocsv([]string{"loglines1.log", "loglines2.log"}, configFile, []string{}, true, false)
+	if !assert.NotNil(t, tocsv, "not able to create tocsv instance") {
+		getCapturedStdout()
+		return
+	}
+	tocsv.SetPrintLogLines(true)
+	tocsv.Run()
+
+	output := getCapturedStdout()
+	expectedOutput := `__file__,__lineno__,__offset__,price,__logline__
+loglines1.log,1,0,123.5,"2020-06-02 14:33:56.531063 ORDER NEW price: 123.5, quantity: 1000"
+loglines2.log,1,0,"1,5","2020-06-02 14:34:30.000000 ORDER NEW price: 1,5, quantity: 5"
+loglines1.log,3,103,99.5,"2020-06-02 14:35:00.000000 ORDER NEW price: 99.5, quantity: 10"
+`
+	assert.Equal(t, expectedOutput, output)
+}
+
+var gJoinLogLines = []string{
+	"2020-06-02 10:00:00.000000 ORDER NEW orderId: 1, securityId: 999, price: 100.5",
+	"2020-06-02 10:00:01.000000 EXEC orderId: 1, securityId: 999, fillQty: 10",
+	"2020-06-02 10:00:02.000000 ORDER NEW orderId: 2, securityId: 154, price: 20.25",
+	"2020-06-02 10:00:03.000000 EXEC orderId: 1, securityId: 999, fillQty: 5",
+	"2020-06-02 10:00:04.000000 EXEC orderId: 3, securityId: 154, fillQty: 7",
+	"2020-06-02 10:00:05.000000 ORDER NEW orderId: 4, securityId: 999, price: 101",
+	"2020-06-02 10:00:06.000000 EXEC orderId: 5, securityId: 999, fillQty: 1",
+}
+
+func runJoinTocsv(t *testing.T, joinConfig string, logLines []string) string {
+	captureStdout()
+
+	fname := "join.log"
+	gMfs.SetFileData(fname, logLines)
+	configFile := "join_tocsv.yaml"
+	gMfs.SetFileData(configFile, strings.Split(joinConfig+`
+Apps:
+    - AppName: Orders
+      LogLines:
+          - Tag: NEW
+            Patterns: ['ORDER NEW']
+            ExampleLine: '2020-06-02 10:00:00.000000 ORDER NEW orderId: 1, securityId: 999, price: 100.5'
+            Elements:
+                TimeStampKey:
+                    ColumnName: timestamp
+                    StartPattern: '^'
+                    PatternLength: 26
+                    Type: timestamp
+                    Layout: '2006-01-02 15:04:05.000000'
+                OrderIdKey:
+                    ColumnName: orderId
+                    StartPattern: 'orderId: '
+                    EndPattern: ','
+                    Type: int
+                    OnTypeError: N/F
+                SecurityIdKey:
+                    ColumnName: securityId
+                    StartPattern: 'securityId: '
+                    EndPattern: ','
+                PriceKey:
+                    ColumnName: price
+                    StartPattern: 'price: '
+                    EndPattern: '$'
+    - AppName: Executions
+      LogLines:
+          - Tag: EXEC
+            Patterns: ['EXEC']
+            ExampleLine: '2020-06-02 10:00:01.000000 EXEC orderId: 1, securityId: 999, fillQty: 10'
+            Elements:
+                TimeStampKey:
+                    ColumnName: timestamp
+                    StartPattern: '^'
+                    PatternLength: 26
+                    Type: timestamp
+                    Layout: '2006-01-02 15:04:05.000000'
+                OrderIdKey:
+                    ColumnName: orderId
+                    StartPattern: 'orderId: '
+                    EndPattern: ','
+                    Type: int
+                    OnTypeError: N/F
+                SecurityIdKey:
+                    ColumnName: securityId
+                    StartPattern: 'securityId: '
+                    EndPattern: ','
+                FillQtyKey:
+                    ColumnName: fillQty
+                    StartPattern: 'fillQty: '
+                    EndPattern: '$'
+`, "\n"))
+
+	tocsv := tocsvgo.NewTocsv([]string{fname}, configFile, []string{}, true, false)
+	if tocsv != nil {
+		tocsv.Run()
+	}
+	output := getCapturedStdout()
+	// output of the join is printed after the outputs of the apps
+	if i := strings.Index(output, "\ntimestamp,orderId,securityId,fillQty,Orders.timestamp"); i > -1 {
+		return output[i+1:]
+	}
+	return output
+}
+
+func Test_Joins_inner_and_left_match_the_records_on_key_columns(t *testing.T) {
+	output := runJoinTocsv(t, `
+Joins:
+    - Name: Fills
+      Left: Executions
+      Right: Orders
+      On: [orderId]
+`, gJoinLogLines)
+	assert.Equal(t, `timestamp,orderId,securityId,fillQty,Orders.timestamp,Orders.securityId,price
+2020-06-02 10:00:01.000000,1,999,10,2020-06-02 10:00:00.000000,999,100.5
+2020-06-02 10:00:03.000000,1,999,5,2020-06-02 10:00:00.000000,999,100.5
+`, output)
+
+	output = runJoinTocsv(t, `
+Joins:
+    - Name: Fills
+      Left: Executions
+      Right: Orders
+      On: [orderId, securityId]
+      Mode: left
+`, gJoinLogLines)
+	assert.Equal(t, `timestamp,orderId,securityId,fillQty,Orders.timestamp,price
+2020-06-02 10:00:01.000000,1,999,10,2020-06-02 10:00:00.000000,100.5
+2020-06-02 10:00:03.000000,1,999,5,2020-06-02 10:00:00.000000,100.5
+2020-06-02 10:00:04.000000,3,154,7,N/A,N/A
+2020-06-02 10:00:06.000000,5,999,1,N/A,N/A
+`, output)
+}
+
+func Test_Joins_asof_matches_the_latest_record_before_the_timestamp(t *testing.T) {
+	output := runJoinTocsv(t, `
+Joins:
+    - Name: LastOrder
+      Left: Executions
+      Right: Orders
+      On: [securityId]
+      Mode: asof
+      Timestamp: timestamp
+`, gJoinLogLines)
+	assert.Equal(t, `timestamp,orderId,securityId,fillQty,Orders.timestamp,Orders.orderId,price
+2020-06-02 10:00:01.000000,1,999,10,2020-06-02 10:00:00.000000,1,100.5
+2020-06-02 10:00:03.000000,1,999,5,2020-06-02 10:00:00.000000,1,100.5
+2020-06-02 10:00:04.000000,3,154,7,2020-06-02 10:00:02.000000,2,20.25
+2020-06-02 10:00:06.000000,5,999,1,2020-06-02 10:00:05.000000,4,101
+`, output)
+}
+
+func Test_Joins_do_not_match_the_records_without_keys(t *testing.T) {
+	logLines := []string{
+		"2020-06-02 10:00:00.000000 ORDER NEW orderId: x, securityId: 999, price: 100.5",
+		"2020-06-02 10:00:01.000000 EXEC orderId: y, securityId: 999, fillQty: 10",
+	}
+	output := runJoinTocsv(t, `
+Joins:
+    - {Name: Fills, Left: Executions, Right: Orders, On: [orderId], Mode: left}
+`, logLines)
+	assert.Equal(t, `timestamp,orderId,securityId,fillQty,Orders.timestamp,Orders.securityId,price
+2020-06-02 10:00:01.000000,N/F,999,10,N/A,N/A,N/A
+`, output)
+}
+
+func Test_Joins_write_the_Left_records_without_the_records_of_Right(t *testing.T) {
+	logLines := []string{
+		"2020-06-02 10:00:01.000000 EXEC orderId: 1, securityId: 999, fillQty: 10",
+	}
+	output := runJoinTocsv(t, `
+Joins:
+    - {Name: LastOrder, Left: Executions, Right: Orders, On: [securityId], Mode: asof, Timestamp: timestamp}
+`, logLines)
+	assert.Equal(t, `timestamp,orderId,securityId,fillQty,Orders.timestamp,Orders.orderId,price
+2020-06-02 10:00:01.000000,1,999,10,N/A,N/A,N/A
+`, output)
+
+	output = runJoinTocsv(t, `
+Joins:
+    - {Name: Fills, Left: Executions, Right: Orders, On: [orderId]}
+`, logLines)
+	assert.Contains(t, output, "WARN, join Fills is not written as there are no records of Executions or Orders")
+}
+
+func Test_invalid_Joins_are_rejected(t *testing.T) {
+	output := runJoinTocsv(t, `
+Joins:
+    - Name: LastOrder
+      Left: Executions
+      Right: Orders
+      On: [securityId]
+      Mode: asof
+`, gJoinLogLines)
+	assert.Contains(t, output, "ERROR, invalid Joins config, please provide Timestamp of the join LastOrder for Mode asof")
+
+	output = runJoinTocsv(t, `
+Joins:
+    - Name: Fills
+      Left: Executions
+      Right: Orders
+      On: [fillQty]
+`, gJoinLogLines)
+	assert.Contains(t, output, "ERROR, invalid Joins config, column fillQty of app Orders is not found for the join Fills")
+	// nothing is written when the config is invalid
+	assert.NotContains(t, output, "timestamp,orderId")
+
+	output = runJoinTocsv(t, `
+Joins:
+    - {Name: Fills, Left: Executions, Right: Order, On: [orderId]}
+`, gJoinLogLines)
+	assert.Contains(t, output, "ERROR, invalid Joins config, app Order of the join Fills is not found")
+}
+
+var gAggregationLogLines = []string{
+	"2020-06-02 10:00:00.000000 ORDER ACK securityId: 999, side: BUY, quantity: 100, price: 10.5, latency: 1.5ms",
+	"2020-06-02 10:00:01.000000 ORDER ACK securityId: 154, side: SELL, quantity: 20, price: 99, latency: 300us",
+	"2020-06-02 10:00:02.000000 ORDER ACK securityId: 999, side: BUY, quantity: 300, price: 11.5, latency: 2ms",
+	"2020-06-02 10:00:03.000000 ORDER ACK securityId: 999, side: SELL, quantity: 50, price: 12, latency: 1ms",
+	"2020-06-02 10:00:04.000000 ORDER ACK securityId: 999, side: BUY, quantity: 600, price: 12.5, latency: 10ms",
+}
+
+func runAggregationTocsv(t *testing.T, aggregationConfig string, logLines []string) string {
+	captureStdout()
+
+	fname := "aggregation.log"
+	gMfs.SetFileData(fname, logLines)
+	configFile := "aggregation_tocsv.yaml"
+	gMfs.SetFileData(configFile, strings.Split(aggregationConfig+`
+Apps:
+    - AppName: Orders
+      LogLines:
+          - Tag: ACK
+            Patterns: ['ORDER ACK']
+            ExampleLine: '2020-06-02 10:00:00.000000 ORDER ACK securityId: 999, side: BUY, quantity: 100, price: 10.5, latency: 1.5ms'
+            Elements:
+                TimeStampKey:
+                    ColumnName: timestamp
+                    StartPattern: '^'
+                    PatternLength: 26
+                    Type: timestamp
+                    Layout: '2006-01-02 15:04:05.000000'
+                SecurityIdKey:
+                    ColumnName: securityId
+                    StartPattern: 'securityId: '
+                    EndPattern: ','
+                SideKey:
+                    ColumnName: side
+                    StartPattern: 'side: '
+                    EndPattern: ','
+                QuantityKey:
+                    ColumnName: quantity
+                    StartPattern: 'quantity: '
+                    EndPattern: ','
+                    Type: int
+                    OnTypeError: N/F
+                PriceKey:
+                    ColumnName: price
+                    StartPattern: 'price: '
+                    EndPattern: ','
+                LatencyKey:
+                    ColumnName: latency
+                    StartPattern: 'latency: '
+                    EndPattern: '$'
+                    Type: duration
+`, "\n"))
+
+	tocsv := tocsvgo.NewTocsv([]string{fname}, configFile, []string{}, true, false)
+	if tocsv != nil {
+		tocsv.Run()
+	}
+	return getCapturedStdout()
+}
+
+func Test_Aggregations_write_a_summary_table_of_the_app(t *testing.T) {
+	output := runAggregationTocsv(t, `
+Aggregations:
+    - Name: OrdersSummary
+      App: Orders
+      GroupBy: [securityId, side]
+      Aggregates: ['count()', 'sum(quantity)', 'avg(price)', 'min(timestamp)', 'max(timestamp)', 'p50(latency)', 'max(latency)']
+`, gAggregationLogLines)
+	// summary table is printed after the records of the app
+	assert.Equal(t, `timestamp,securityId,side,quantity,price,latency
+2020-06-02 10:00:00.000000,999,BUY,100,10.5,1.5ms
+2020-06-02 10:00:01.000000,154,SELL,20,99,300us
+2020-06-02 10:00:02.000000,999,BUY,300,11.5,2ms
+2020-06-02 10:00:03.000000,999,SELL,50,12,1ms
+2020-06-02 10:00:04.000000,999,BUY,600,12.5,10ms
+securityId,side,count,sum_quantity,avg_price,min_timestamp,max_timestamp,p50_latency,max_latency
+999,BUY,3,1000,11.5,2020-06-02 10:00:00.000000,2020-06-02 10:00:04.000000,2ms,10ms
+154,SELL,1,20,99,2020-06-02 10:00:01.000000,2020-06-02 10:00:01.000000,300µs,300us
+999,SELL,1,50,12,2020-06-02 10:00:03.000000,2020-06-02 10:00:03.000000,1ms,1ms
+`, output)
+
+	output = runAggregationTocsv(t, `
+Aggregations:
+    - Name: AllOrders
+      App: Orders
+      Aggregates: ['count(price)', 'p99(latency)', 'p50(quantity)']
+`, gAggregationLogLines)
+	assert.True(t, strings.HasSuffix(output, "count_price,p99_latency,p50_quantity\n5,10ms,100\n"), output)
+}
+
+func Test_Aggregations_sum_large_ints_exactly(t *testing.T) {
+	output := runAggregationTocsv(t, `
+Aggregations:
+    - {Name: Total, App: Orders, Aggregates: ['sum(quantity)', 'sum(latency)']}
+`, []string{
+		"2020-06-02 10:00:00.000000 ORDER ACK securityId: 999, side: BUY, quantity: 9007199254740993, price: 10.5, latency: 2500000h0m0.000000001s",
+		"2020-06-02 10:00:01.000000 ORDER ACK securityId: 154, side: SELL, quantity: 1, price: 99, latency: 1ns",
+	})
+	assert.True(t, strings.HasSuffix(output, "sum_quantity,sum_latency\n9007199254740994,2500000h0m0.000000002s\n"), output)
+}
+
+func Test_Aggregations_ignore_the_values_which_are_not_found(t *testing.T) {
+	output := runAggregationTocsv(t, `
+Aggregations:
+    - {Name: Total, App: Orders, Aggregates: ['count()', 'count(quantity)', 'min(quantity)', 'max(quantity)', 'sum(quantity)']}
+`, []string{
+		"2020-06-02 10:00:00.000000 ORDER ACK securityId: 999, side: BUY, quantity: 100, price: 10.5, latency: 1.5ms",
+		"2020-06-02 10:00:01.000000 ORDER ACK securityId: 154, side: SELL, quantity: x, price: 99, latency: 300us",
+		"2020-06-02 10:00:02.000000 ORDER ACK securityId: 999, side: BUY, price: 11.5, latency: 2ms",
+		"2020-06-02 10:00:03.000000 ORDER ACK securityId: 999, side: SELL, quantity: 300, price: 12, latency: 1ms",
+	})
+	assert.True(t, strings.HasSuffix(output, "count,count_quantity,min_quantity,max_quantity,sum_quantity\n4,2,100,300,400\n"), output)
+}
+
+func Test_invalid_Aggregations_are_rejected(t *testing.T) {
+	output := runAggregationTocsv(t, `
+Aggregations:
+    - {Name: OrdersSummary, App: Orders, Aggregates: ['median(price)']}
+`, gAggregationLogLines)
+	assert.Contains(t, output, `ERROR, invalid Aggregations config, unknown function of aggregate "median(price)"`)
+
+	output = runAggregationTocsv(t, `
+Aggregations:
+    - {Name: OrdersSummary, App: Orders, Aggregates: ['avg(timestamp)']}
+`, gAggregationLogLines)
+	assert.Contains(t, output, "only count, min and max can be used with the timestamp column timestamp in the aggregation OrdersSummary")
+
+	output = runAggregationTocsv(t, `
+Aggregations:
+    - {Name: OrdersSummary, App: Orders, GroupBy: [orderId], Aggregates: ['count()']}
+`, gAggregationLogLines)
+	assert.Contains(t, output, "ERROR, invalid Aggregations config, GroupBy column orderId of app Orders is not found for the aggregation OrdersSummary")
+	// nothing is written when the config is invalid
+	assert.NotContains(t, output, "timestamp,securityId")
+
+	output = runAggregationTocsv(t, `
+Aggregations:
+    - {Name: OrdersSummary, App: Order, Aggregates: ['count()']}
+`, gAggregationLogLines)
+	assert.Contains(t, output, "ERROR, invalid Aggregations config, app Order of the aggregation OrdersSummary is not found")
+}
+
+func runPairTocsv(t *testing.T, pairConfig string) string {
+	captureStdout()
+
+	fname := "pair.log"
+	gMfs.SetFileData(fname, []string{
+		"2020-06-02 10:00:00.000000 insert order sent, orderId: 1",
+		"2020-06-02 10:00:00.500000 insert order sent, orderId: 2",
+		"2020-06-02 10:00:01.000000 insert order reply, orderId: 2",
+		"2020-06-02 10:00:01.200000 insert order sent, orderId: 3",
+		"2020-06-02 10:00:01.500000 insert order reply, orderId: 1",
+		"2020-06-02 10:00:02.000000 insert order sent, orderId: 2",
+		"2020-06-02 10:00:03.000000 insert order sent, orderId: x",
+		"2020-06-02 10:00:04.000000 insert order reply, orderId: y",
+		"2020-06-02 10:00:09.000000 insert order reply, orderId: 2",
+		"2020-06-02 10:00:09.000000 insert order reply, orderId: 4",
+	})
+	configFile := "pair_tocsv.yaml"
+	gMfs.SetFileData(configFile, strings.Split(pairConfig+`
+Apps:
+    - AppName: Orders
+      LogLines:
+          - Tag: SENT
+            Patterns: ['insert order sent']
+            ExampleLine: '2020-06-02 10:00:00.000000 insert order sent, orderId: 1'
+            Elements: &elements
+                TimeStampKey:
+                    ColumnName: timestamp
+                    StartPattern: '^'
+                    PatternLength: 26
+                    Type: timestamp
+                    Layout: '2006-01-02 15:04:05.000000'
+                OrderIdKey:
+                    ColumnName: orderId
+                    StartPattern: 'orderId: '
+                    EndPattern: '$'
+                    Type: int
+                    OnTypeError: N/F
+          - Tag: REPLY
+            Patterns: ['insert order reply']
+            ExampleLine: '2020-06-02 10:00:01.000000 insert order reply, orderId: 2'
+            Elements: *elements
+`, "\n"))
+
+	tocsv := tocsvgo.NewTocsv([]string{fname}, configFile, []string{}, true, false)
+	if tocsv != nil {
+		tocsv.Run()
+	}
+	return getCapturedStdout()
+}
+
+func Test_Pairs_write_the_latency_between_start_and_end_records(t *testing.T) {
+	output := runPairTocsv(t, `
+Pairs:
+    - {Name: OrderLatency, App: Orders, Start: SENT, End: REPLY, On: [orderId], Timestamp: timestamp}
+`)
+	// pairs and unmatched starts are printed after the records of the app, records whose orderId is N/F are not paired
+	assert.True(t, strings.HasSuffix(output, `orderId,SENT.timestamp,REPLY.timestamp,latency
+2,2020-06-02 10:00:00.500000,2020-06-02 10:00:01.000000,500ms
+1,2020-06-02 10:00:00.000000,2020-06-02 10:00:01.500000,1.5s
+2,2020-06-02 10:00:02.000000,2020-06-02 10:00:09.000000,7s
+orderId,SENT.timestamp
+3,2020-06-02 10:00:01.200000
+`), output)
+
+	// second order 2 is not replied within the Timeout
+	output = runPairTocsv(t, `
+Pairs:
+    - {Name: OrderLatency, App: Orders, Start: SENT, End: REPLY, On: [orderId], Timestamp: timestamp, Timeout: 5s}
+`)
+	assert.True(t, strings.HasSuffix(output, `orderId,SENT.timestamp,REPLY.timestamp,latency
+2,2020-06-02 10:00:00.500000,2020-06-02 10:00:01.000000,500ms
+1,2020-06-02 10:00:00.000000,2020-06-02 10:00:01.500000,1.5s
+orderId,SENT.timestamp
+3,2020-06-02 10:00:01.200000
+2,2020-06-02 10:00:02.000000
+`), output)
+}
+
+func Test_invalid_Pairs_are_rejected(t *testing.T) {
+	output := runPairTocsv(t, `
+Pairs:
+    - {Name: OrderLatency, App: Orders, Start: SENT, End: REPLY, On: [orderId], Timestamp: timestamp, Timeout: soon}
+`)
+	assert.Contains(t, output, `ERROR, invalid Pairs config, Timeout "soon" of the pair OrderLatency should be a positive duration`)
+
+	output = runPairTocsv(t, `
+Pairs:
+    - {Name: OrderLatency, App: Orders, Start: SENT, End: REPLY, On: [orderId], Timestamp: orderId}
+`)
+	assert.Contains(t, output, "ERROR, invalid Pairs config, column orderId of Type timestamp of app Orders is not found for the pair OrderLatency")
+	// nothing is written when the config is invalid
+	assert.NotContains(t, output, "timestamp,orderId")
+
+	output = runPairTocsv(t, `
+Pairs:
+    - {Name: OrderLatency, App: Orders, Start: SENT, End: ACK, On: [orderId], Timestamp: timestamp}
+`)
+	assert.Contains(t, output, "ERROR, invalid Pairs config, tag ACK of app Orders is not found for the pair OrderLatency")
+
+	output = runPairTocsv(t, `
+Pairs:
+    - {Name: OrderLatency, App: Order, Start: SENT, End: REPLY, On: [orderId], Timestamp: timestamp}
+`)
+	assert.Contains(t, output, "ERROR, invalid Pairs config, app Order of the pair OrderLatency is not found")
+}
@@ -0,0 +1,178 @@
+package tocsvgo
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+	"tocsv/filterlogs"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	gXlsxMaxSheetNameLength = 31
+	gXlsxDefaultSheet       = "Sheet1"
+	gXlsxTimestampFormat    = "yyyy-mm-dd hh:mm:ss.000"
+	gXlsxDurationFormat     = "[h]:mm:ss.000"
+)
+
+// xlsxWorkbook stores the output of each app in its own worksheet of an excel workbook. Workbook is saved when it is
+// closed.
+type xlsxWorkbook struct {
+	fname  string
+	file   *excelize.File
+	sheets []*xlsxSheet
+
+	headerStyle    int
+	timestampStyle int
+	durationStyle  int
+}
+
+func newXlsxWorkbook(fname string) (*xlsxWorkbook, error) {
+	workbook := &xlsxWorkbook{fname: fname, file: excelize.NewFile()}
+	var err error
+	if workbook.headerStyle, err = workbook.file.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}}); err != nil {
+		return nil, err
+	}
+	timestampFormat := gXlsxTimestampFormat
+	if workbook.timestampStyle, err = workbook.file.NewStyle(&excelize.Style{CustomNumFmt: &timestampFormat}); err != nil {
+		return nil, err
+	}
+	durationFormat := gXlsxDurationFormat
+	if workbook.durationStyle, err = workbook.file.NewStyle(&excelize.Style{CustomNumFmt: &durationFormat}); err != nil {
+		return nil, err
+	}
+	return workbook, nil
+}
+
+// xlsxSheetName returns the AppName as a valid sheet name, excel does not allow some characters and names longer than
+// 31 characters
+func xlsxSheetName(appName string) string {
+	name := strings.NewReplacer(":", "_", `\`, "_", "/", "_", "?", "_", "*", "_", "[", "_", "]", "_").Replace(appName)
+	if runes := []rune(name); len(runes) > gXlsxMaxSheetNameLength {
+		name = string(runes[:gXlsxMaxSheetNameLength])
+	}
+	return name
+}
+
+// newSink adds the worksheet of the app with a bold header row, frozen panes below the header and an autofilter on
+// the columns
+func (workbook *xlsxWorkbook) newSink(appName string, columns []*filterlogs.MetaInfoType) (sink, error) {
+	sheet := xlsxSheetName(appName)
+	for _, s := range workbook.sheets {
+		if strings.EqualFold(s.name, sheet) {
+			return nil, fmt.Errorf("sheet name %s of app %s is already used by another app", sheet, appName)
+		}
+	}
+	if len(workbook.sheets) == 0 {
+		// new workbook has a default sheet, it is used for the first app
+		workbook.file.SetSheetName(gXlsxDefaultSheet, sheet)
+	} else {
+		workbook.file.NewSheet(sheet)
+	}
+	// panes are a part of the sheet view which is written by the stream writer when it is created
+	panes := `{"freeze":true,"split":false,"x_split":0,"y_split":1,"top_left_cell":"A2","active_pane":"bottomLeft"}`
+	if err := workbook.file.SetPanes(sheet, panes); err != nil {
+		return nil, err
+	}
+	writer, err := workbook.file.NewStreamWriter(sheet)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]interface{}, 0, len(columns))
+	for _, name := range columnNames(columns) {
+		header = append(header, excelize.Cell{StyleID: workbook.headerStyle, Value: name})
+	}
+	s := &xlsxSheet{workbook: workbook, name: sheet, columns: columns, writer: writer, row: 1}
+	if err = s.writeRow(header); err != nil {
+		return nil, err
+	}
+	workbook.sheets = append(workbook.sheets, s)
+	return s, nil
+}
+
+func (workbook *xlsxWorkbook) close() error {
+	for _, s := range workbook.sheets {
+		lastCell, err := excelize.CoordinatesToCellName(len(s.columns), s.row-1)
+		if err != nil {
+			return err
+		}
+		// autofilter is written by the stream writer when it is flushed
+		if err = workbook.file.AutoFilter(s.name, "A1", lastCell, ""); err != nil {
+			return err
+		}
+		if err = s.writer.Flush(); err != nil {
+			return err
+		}
+	}
+	return workbook.file.SaveAs(workbook.fname)
+}
+
+// xlsxSheet writes the records of an app in its worksheet
+type xlsxSheet struct {
+	workbook *xlsxWorkbook
+	name     string
+	columns  []*filterlogs.MetaInfoType
+	writer   *excelize.StreamWriter
+	row      int // next row to be written
+}
+
+func (s *xlsxSheet) writeRow(values []interface{}) error {
+	cell, err := excelize.CoordinatesToCellName(1, s.row)
+	if err != nil {
+		return err
+	}
+	if err = s.writer.SetRow(cell, values); err != nil {
+		return err
+	}
+	s.row++
+	return nil
+}
+
+func (s *xlsxSheet) write(record []*filterlogs.FilteredData) error {
+	values := make([]interface{}, len(record))
+	for i, filteredData := range record {
+		values[i] = s.cellValue(filteredData)
+	}
+	return s.writeRow(values)
+}
+
+// cellValue returns the value of the element for its cell. Typed elements are written with their type, other values
+// are written as numbers when they can be parsed as numbers. N/A values are empty cells.
+func (s *xlsxSheet) cellValue(filteredData *filterlogs.FilteredData) interface{} {
+	if filteredData == nil {
+		return nil
+	}
+	switch value := filteredData.Value.(type) {
+	case int64, float64, bool:
+		return value
+	case *big.Rat:
+		f, _ := value.Float64()
+		return f
+	case time.Duration:
+		return excelize.Cell{StyleID: s.workbook.durationStyle, Value: value}
+	case time.Time:
+		return excelize.Cell{StyleID: s.workbook.timestampStyle, Value: value}
+	}
+	if i, err := strconv.ParseInt(filteredData.Text, 10, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(filteredData.Text, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+		return f
+	}
+	return filteredData.Text
+}
+
+// flush does nothing as the workbook can only be written when it is closed
+func (s *xlsxSheet) flush() error {
+	return nil
+}
+
+// close does nothing as the sheets are written when the workbook is closed
+func (s *xlsxSheet) close() error {
+	return nil
+}